@@ -0,0 +1,45 @@
+package main
+
+import (
+	"coding_test_2/internal/api"
+	"coding_test_2/internal/config"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// startHTTPServer serves the API until ctx is cancelled
+func startHTTPServer(ctx context.Context, cfg *config.Config, server *api.Server) error {
+	srv := &http.Server{
+		Addr:    cfg.HTTP.Addr,
+		Handler: server.Handler(),
+		// Derive request contexts from ctx so long-lived event streams end on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		log.Println("[HTTP] Listening on", cfg.HTTP.Addr)
+		errChan <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errChan:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("[HTTP] Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+	}
+	return nil
+}
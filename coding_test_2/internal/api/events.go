@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// sseKeepAliveInterval keeps idle connections from being closed by proxies
+const sseKeepAliveInterval = 15 * time.Second
+
+// streamReportEvents streams report status transitions as Server-Sent Events
+// GET /reports/events streams all reports of the tenant, GET /reports/{id}/events a single one
+func (s *Server) streamReportEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	requestID := r.PathValue("id")
+	updates, err := s.notifier.Subscribe(r.Context(), requestTenant(r), requestID)
+	if err != nil {
+		log.Printf("[API] Failed to subscribe to status events: %v", err)
+		writeError(w, http.StatusServiceUnavailable, "status events unavailable")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case result, ok := <-updates:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(result)
+			if err != nil {
+				log.Printf("[API] Failed to marshal status event for %s: %v", result.RequestID, err)
+				continue
+			}
+
+			fmt.Fprintf(w, "event: status\nid: %s\ndata: %s\n\n", result.RequestID, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"coding_test_2/internal/models"
+	"net/http"
+)
+
+// getLiveness reports whether the process works, a failure asks for a restart
+// GET /healthz
+func (s *Server) getLiveness(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, s.health.Liveness(r.Context()))
+}
+
+// getReadiness reports whether the process can take work, it fails while starting or draining
+// GET /readyz
+func (s *Server) getReadiness(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, s.health.Readiness(r.Context()))
+}
+
+// writeHealthReport writes a report with 200 if it passed and 503 otherwise
+func writeHealthReport(w http.ResponseWriter, report models.HealthReport) {
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != models.HealthOK {
+		writeJSON(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
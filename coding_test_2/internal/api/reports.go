@@ -0,0 +1,162 @@
+package api
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/generators"
+	"coding_test_2/internal/messages"
+	"coding_test_2/internal/models"
+	"coding_test_2/internal/services"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRequestBodySize bounds the size of report submissions
+const maxRequestBodySize = 1 << 20
+
+// submitReport validates a report request and queues it for processing
+// POST /reports
+func (s *Server) submitReport(w http.ResponseWriter, r *http.Request) {
+	var request models.ReportRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if tenantID := r.Header.Get(config.TENANT_ID_HEADER); tenantID != "" {
+		if request.TenantID != "" && request.TenantID != tenantID {
+			writeError(w, http.StatusBadRequest, "tenant_id does not match the "+config.TENANT_ID_HEADER+" header")
+			return
+		}
+		request.TenantID = tenantID
+	}
+
+	// Callers may correlate the request's messages with their own, the report ID is used otherwise
+	ctx := r.Context()
+	if correlationID := r.Header.Get(config.CORRELATION_ID_HEADER); correlationID != "" {
+		ctx = messages.WithCorrelationID(ctx, correlationID)
+	}
+
+	submitted, err := s.reports.SubmitReport(ctx, request)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/reports/"+submitted.ID)
+	writeJSON(w, http.StatusAccepted, submitted)
+}
+
+// getReport returns the latest status of a report
+// GET /reports/{id}
+func (s *Server) getReport(w http.ResponseWriter, r *http.Request) {
+	result, err := s.reports.GetReport(r.Context(), requestTenant(r), r.PathValue("id"))
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// getReportHistory returns the status transitions of a report
+// GET /reports/{id}/history
+func (s *Server) getReportHistory(w http.ResponseWriter, r *http.Request) {
+	history, err := s.reports.GetReportHistory(r.Context(), requestTenant(r), r.PathValue("id"))
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// cancelReport cancels a queued or running report
+// POST /reports/{id}/cancel
+func (s *Server) cancelReport(w http.ResponseWriter, r *http.Request) {
+	result, err := s.reports.CancelReport(r.Context(), requestTenant(r), r.PathValue("id"))
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// getDownloadURL returns a time-limited URL to download the report artifact
+// GET /reports/{id}/download-url
+func (s *Server) getDownloadURL(w http.ResponseWriter, r *http.Request) {
+	downloadURL, expiresAt, err := s.reports.DownloadURL(r.Context(), requestTenant(r), r.PathValue("id"))
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"url":        downloadURL,
+		"expires_at": expiresAt.Format(time.RFC3339),
+	})
+}
+
+// downloadReport streams the report artifact, the URL must be signed by getDownloadURL
+// GET /reports/{id}/download?tenant=...&expires=...&signature=...
+// The signed URL names the tenant, it is handed out to clients that may not send the header
+func (s *Server) downloadReport(w http.ResponseWriter, r *http.Request) {
+	requestID := r.PathValue("id")
+	query := r.URL.Query()
+	tenantID := query.Get("tenant")
+	if err := s.reports.VerifyDownload(tenantID, requestID, query.Get("expires"), query.Get("signature")); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	metadata, content, err := s.reports.OpenArtifact(r.Context(), tenantID, requestID)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	defer content.Close()
+
+	filename := requestID + "." + strings.ToLower(string(metadata.Format))
+	w.Header().Set("Content-Type", metadata.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(metadata.Size, 10))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("X-Checksum-Sha256", metadata.Checksum)
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("[API] Failed to stream artifact for %s: %v", requestID, err)
+	}
+}
+
+// requestTenant returns the tenant an API request acts for, named by the TENANT_ID_HEADER
+// Requests without it act for the default tenant, like submissions without a tenant_id
+func requestTenant(r *http.Request) string {
+	if tenantID := r.Header.Get(config.TENANT_ID_HEADER); tenantID != "" {
+		return tenantID
+	}
+	return models.DefaultTenant
+}
+
+// writeReportError maps report service errors to HTTP responses
+func writeReportError(w http.ResponseWriter, err error) {
+	var rateLimitErr *services.RateLimitError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		retryAfter := int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		writeError(w, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, services.ErrReportNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrArtifactNotAvailable), errors.Is(err, services.ErrReportExists),
+		errors.Is(err, models.ErrInvalidTransition):
+		writeError(w, http.StatusConflict, err.Error())
+	case generators.IsPermanent(err), errors.Is(err, services.ErrInvalidPriority), errors.Is(err, services.ErrInvalidCallback),
+		errors.Is(err, services.ErrInvalidTenant):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Printf("[API] Request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
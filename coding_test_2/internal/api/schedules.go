@@ -0,0 +1,89 @@
+package api
+
+import (
+	"coding_test_2/internal/generators"
+	"coding_test_2/internal/models"
+	"coding_test_2/internal/services"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// createSchedule stores a recurring report schedule
+// POST /schedules
+func (s *Server) createSchedule(w http.ResponseWriter, r *http.Request) {
+	var schedule models.Schedule
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&schedule); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	created, err := s.schedules.CreateSchedule(r.Context(), schedule)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/schedules/"+created.ID)
+	writeJSON(w, http.StatusCreated, redactSchedule(*created))
+}
+
+// listSchedules returns every schedule ordered by next run
+// GET /schedules
+func (s *Server) listSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := s.schedules.ListSchedules(r.Context())
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	for i := range schedules {
+		schedules[i] = redactSchedule(schedules[i])
+	}
+	writeJSON(w, http.StatusOK, schedules)
+}
+
+// getSchedule returns a schedule with its last and next run
+// GET /schedules/{id}
+func (s *Server) getSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := s.schedules.GetSchedule(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, redactSchedule(*schedule))
+}
+
+// redactSchedule returns the schedule without its callback secret, which is only written
+// on creation and used to sign the webhooks of its runs
+func redactSchedule(schedule models.Schedule) models.Schedule {
+	schedule.CallbackSecret = ""
+	return schedule
+}
+
+// deleteSchedule removes a schedule
+// DELETE /schedules/{id}
+func (s *Server) deleteSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := s.schedules.DeleteSchedule(r.Context(), r.PathValue("id")); err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeScheduleError maps scheduler service errors to HTTP responses
+func writeScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrScheduleNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrScheduleExists):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidSchedule), generators.IsPermanent(err):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Printf("[API] Request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"coding_test_2/internal/metrics"
+	"coding_test_2/internal/services"
+	"coding_test_2/internal/tracing"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Server exposes the report processing system over HTTP
+type Server struct {
+	notifier  services.NotifierServiceInterface
+	reports   services.ReportServiceInterface
+	schedules services.SchedulerServiceInterface
+	health    services.HealthServiceInterface
+}
+
+func NewServer(notifier services.NotifierServiceInterface, reports services.ReportServiceInterface, schedules services.SchedulerServiceInterface, health services.HealthServiceInterface) *Server {
+	return &Server{
+		notifier:  notifier,
+		reports:   reports,
+		schedules: schedules,
+		health:    health,
+	}
+}
+
+// Handler returns the HTTP routes of the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /reports", s.submitReport)
+	mux.HandleFunc("GET /reports/{id}", s.getReport)
+	mux.HandleFunc("GET /reports/{id}/history", s.getReportHistory)
+	mux.HandleFunc("POST /reports/{id}/cancel", s.cancelReport)
+	mux.HandleFunc("GET /reports/{id}/download-url", s.getDownloadURL)
+	mux.HandleFunc("GET /reports/{id}/download", s.downloadReport)
+	mux.HandleFunc("GET /reports/events", s.streamReportEvents)
+	mux.HandleFunc("GET /reports/{id}/events", s.streamReportEvents)
+	mux.HandleFunc("POST /schedules", s.createSchedule)
+	mux.HandleFunc("GET /schedules", s.listSchedules)
+	mux.HandleFunc("GET /schedules/{id}", s.getSchedule)
+	mux.HandleFunc("DELETE /schedules/{id}", s.deleteSchedule)
+	mux.HandleFunc("GET /healthz", s.getLiveness)
+	mux.HandleFunc("GET /readyz", s.getReadiness)
+	mux.Handle("GET /metrics", metrics.Handler())
+	return traced(mux)
+}
+
+// untracedPaths are polled by infrastructure, their requests would only clutter the traces
+var untracedPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// traced continues the trace of the caller, if any, in a server span around every request
+// The span is named after the matched route once the mux has routed the request
+func traced(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if untracedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := tracing.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		r = r.WithContext(ctx)
+		next.ServeHTTP(w, r)
+		if r.Pattern != "" {
+			span.SetName(r.Pattern)
+		}
+	})
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[API] Failed to write response: %v", err)
+	}
+}
+
+// writeError writes an error message as a JSON response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
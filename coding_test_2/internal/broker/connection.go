@@ -0,0 +1,207 @@
+package broker
+
+import (
+	"coding_test_2/internal/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// ErrClosed is returned once the connection has been closed with Close
+var ErrClosed = errors.New("broker connection closed")
+
+// Topology declares the exchanges, queues and bindings the application relies on
+// It runs on every (re)connection, so declarations must be idempotent
+type Topology func(ch *amqp.Channel) error
+
+// Options configures a Connection
+type Options struct {
+	URL            string
+	InitialBackoff time.Duration // Delay before the first reconnection attempt, doubled on each failure
+	MaxBackoff     time.Duration // Upper bound for the reconnection delay
+}
+
+// Connection is a RabbitMQ connection that recovers from broker restarts and network failures
+// It watches NotifyClose, reconnects with backoff and re-declares the topology
+// Publishers block while reconnecting and Consumers are re-established transparently
+type Connection struct {
+	opts     Options
+	topology Topology
+
+	mu        sync.Mutex
+	conn      *amqp.Connection
+	pub       *publishChannel // Channel used for publishing, in confirm mode
+	connected chan struct{}   // Closed while connected, replaced when the connection is lost
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to RabbitMQ and declares the topology
+// The initial connection is not retried so misconfiguration surfaces at startup
+func Dial(ctx context.Context, opts Options, topology Topology) (*Connection, error) {
+	c := &Connection{
+		opts:      opts,
+		topology:  topology,
+		connected: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect dials, opens the publishing channel, declares the topology and starts watching for failures
+func (c *Connection) connect() error {
+	conn, err := amqp.Dial(c.opts.URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+
+	if err := c.topology(ch); err != nil {
+		ch.Close()
+		conn.Close()
+		return fmt.Errorf("failed to declare topology: %w", err)
+	}
+
+	pub, err := newPublishChannel(ch)
+	if err != nil {
+		ch.Close()
+		conn.Close()
+		return err
+	}
+
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.mu.Lock()
+	c.conn = conn
+	c.pub = pub
+	close(c.connected)
+	c.mu.Unlock()
+
+	go c.watch(conn, connClosed, chClosed)
+	go pub.trackConfirms(c.republish)
+	return nil
+}
+
+// watch waits for the connection or the publishing channel to close and reconnects
+func (c *Connection) watch(conn *amqp.Connection, connClosed, chClosed <-chan *amqp.Error) {
+	var reason *amqp.Error
+	select {
+	case reason = <-connClosed:
+	case reason = <-chClosed:
+		// A channel exception leaves the connection open, start over with a fresh one
+		conn.Close()
+	case <-c.done:
+		return
+	}
+
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	log.Printf("[RabbitMQ] Connection lost: %v", reason)
+	metrics.RabbitMQErrors.WithLabelValues("connection").Inc()
+
+	c.mu.Lock()
+	c.connected = make(chan struct{})
+	c.mu.Unlock()
+
+	c.reconnect()
+}
+
+// reconnect retries connect with exponential backoff until it succeeds or Close is called
+func (c *Connection) reconnect() {
+	backoff := c.opts.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(backoff):
+		case <-c.done:
+			return
+		}
+
+		log.Printf("[RabbitMQ] Reconnecting (attempt %d)...", attempt)
+		if err := c.connect(); err != nil {
+			log.Printf("[RabbitMQ] Reconnection failed: %v", err)
+			metrics.RabbitMQErrors.WithLabelValues("reconnect").Inc()
+			backoff *= 2
+			if backoff > c.opts.MaxBackoff {
+				backoff = c.opts.MaxBackoff
+			}
+			continue
+		}
+
+		log.Println("[RabbitMQ] Reconnected")
+		return
+	}
+}
+
+// waitConnected blocks until the connection is up and returns it along with the publishing channel
+func (c *Connection) waitConnected(ctx context.Context) (*amqp.Connection, *publishChannel, error) {
+	for {
+		c.mu.Lock()
+		conn, pub, connected := c.conn, c.pub, c.connected
+		c.mu.Unlock()
+
+		select {
+		case <-connected:
+			if !conn.IsClosed() {
+				return conn, pub, nil
+			}
+			// The watcher has not noticed the failure yet, give it a moment
+			select {
+			case <-time.After(100 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-c.done:
+			return nil, nil, ErrClosed
+		}
+	}
+}
+
+// IsConnected reports whether the connection is currently up
+func (c *Connection) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.connected:
+		return !c.conn.IsClosed()
+	default:
+		return false
+	}
+}
+
+// Close closes the connection and stops reconnecting, Consumers stop delivering
+func (c *Connection) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.conn != nil {
+			err = c.conn.Close()
+		}
+	})
+	return err
+}
@@ -0,0 +1,219 @@
+package broker
+
+import (
+	"coding_test_2/internal/metrics"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Consumer delivers messages from a queue across reconnections
+// Each consumer uses its own channel so its prefetch limit does not affect others
+// Deliveries received before a reconnection can no longer be acked, RabbitMQ redelivers them
+type Consumer struct {
+	conn       *Connection
+	queue      string
+	tag        string
+	deliveries chan amqp.Delivery
+
+	mu         sync.Mutex
+	ch         *amqp.Channel
+	prefetch   int
+	cancelled  bool // Set by Cancel, the consumer is not re-registered afterwards
+	registered bool // Whether the broker currently delivers to the consumer
+}
+
+// Consume starts consuming queue with the given prefetch limit until ctx is cancelled
+func (c *Connection) Consume(ctx context.Context, queue string, prefetch int) (*Consumer, error) {
+	consumer := &Consumer{
+		conn:       c,
+		queue:      queue,
+		tag:        fmt.Sprintf("%s-%d", queue, time.Now().UnixNano()),
+		prefetch:   prefetch,
+		deliveries: make(chan amqp.Delivery),
+	}
+
+	// Register the first consumer synchronously so startup errors are reported to the caller
+	conn, _, err := c.waitConnected(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := consumer.open(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	go consumer.run(ctx, msgs)
+	return consumer, nil
+}
+
+// Deliveries returns the channel messages are delivered on
+// It is closed once ctx is cancelled or the consumer is cancelled
+func (c *Consumer) Deliveries() <-chan amqp.Delivery {
+	return c.deliveries
+}
+
+// Registered reports whether the consumer is currently registered with the broker
+// It is false while re-establishing the consumer and once it has been cancelled
+func (c *Consumer) Registered() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.registered && !c.cancelled
+}
+
+// Cancel asks the broker to stop delivering messages to the consumer
+// The channel stays open until ctx is cancelled, so deliveries received so far can still
+// be acknowledged; those left unacknowledged are requeued by the broker when it closes
+func (c *Consumer) Cancel() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancelled {
+		return nil
+	}
+	c.cancelled = true
+	if c.ch == nil {
+		return nil
+	}
+	if err := c.ch.Cancel(c.tag, false); err != nil {
+		return fmt.Errorf("failed to cancel consumer of %s: %w", c.queue, err)
+	}
+	return nil
+}
+
+// SetPrefetch changes the prefetch limit, it also applies after reconnecting
+func (c *Consumer) SetPrefetch(prefetch int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.prefetch = prefetch
+	if c.ch == nil {
+		return nil
+	}
+	return setQos(c.ch, prefetch)
+}
+
+// open creates a channel, applies QoS and registers the consumer
+func (c *Consumer) open(conn *amqp.Connection) (<-chan amqp.Delivery, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := setQos(ch, c.prefetch); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	msgs, err := ch.Consume(
+		c.queue, // queue
+		c.tag,   // consumer
+		false,   // auto-ack (we'll manually ack)
+		false,   // exclusive
+		false,   // no-local
+		false,   // no-wait
+		nil,     // args
+	)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to register a consumer: %w", err)
+	}
+
+	c.ch = ch
+	c.registered = true
+	return msgs, nil
+}
+
+// run forwards deliveries and re-registers the consumer whenever its channel closes
+func (c *Consumer) run(ctx context.Context, msgs <-chan amqp.Delivery) {
+	defer func() {
+		c.mu.Lock()
+		if c.ch != nil {
+			c.ch.Close()
+		}
+		c.mu.Unlock()
+	}()
+
+	for {
+		if !c.forward(ctx, msgs) {
+			close(c.deliveries)
+			return
+		}
+
+		c.mu.Lock()
+		c.registered = false
+		cancelled := c.cancelled
+		c.mu.Unlock()
+		if cancelled {
+			// Keep the channel open for acknowledgments of in-flight deliveries
+			log.Printf("[RabbitMQ] Consumer for %s cancelled", c.queue)
+			close(c.deliveries)
+			<-ctx.Done()
+			return
+		}
+
+		log.Printf("[RabbitMQ] Consumer channel for %s closed, re-establishing...", c.queue)
+		for {
+			conn, _, err := c.conn.waitConnected(ctx)
+			if err != nil {
+				close(c.deliveries)
+				return
+			}
+
+			msgs, err = c.open(conn)
+			if err == nil {
+				log.Printf("[RabbitMQ] Consumer for %s re-established", c.queue)
+				break
+			}
+
+			log.Printf("[RabbitMQ] Failed to re-establish consumer for %s: %v", c.queue, err)
+			metrics.RabbitMQErrors.WithLabelValues("consume").Inc()
+			select {
+			case <-time.After(c.conn.opts.InitialBackoff):
+			case <-ctx.Done():
+				close(c.deliveries)
+				return
+			}
+		}
+	}
+}
+
+// forward passes deliveries on until msgs closes (true) or ctx is cancelled (false)
+func (c *Consumer) forward(ctx context.Context, msgs <-chan amqp.Delivery) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case msg, ok := <-msgs:
+			if !ok {
+				return true
+			}
+			select {
+			case c.deliveries <- msg:
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+}
+
+// setQos limits unacknowledged deliveries on the channel
+// The limit is channel-wide (global) so it can be changed while consuming
+func setQos(ch *amqp.Channel, prefetch int) error {
+	err := ch.Qos(
+		prefetch, // prefetch count
+		0,        // prefetch size
+		true,     // global
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set QoS: %w", err)
+	}
+	return nil
+}
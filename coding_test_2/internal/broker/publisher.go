@@ -0,0 +1,185 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// Outcome is the broker's verdict on a published message
+type Outcome string
+
+const (
+	OutcomeConfirmed Outcome = "confirmed" // Routed to at least one queue and persisted
+	OutcomeNacked    Outcome = "nacked"    // Rejected by the broker, e.g. due to an internal error
+	OutcomeReturned  Outcome = "returned"  // Unroutable, no queue is bound for the routing key
+)
+
+// PublishResult reports the outcome of a single published message
+type PublishResult struct {
+	MessageID string
+	Outcome   Outcome
+	Return    *amqp.Return // Set when the message was returned as unroutable
+	Err       error        // Set when the outcome is unknown, e.g. ctx was cancelled while reconnecting
+}
+
+// pendingPublish is a published message awaiting its confirmation
+type pendingPublish struct {
+	ctx      context.Context
+	exchange string
+	key      string
+	msg      amqp.Publishing
+	result   chan PublishResult
+}
+
+// publishChannel is a channel in confirm mode tracking the delivery tag of every published message
+type publishChannel struct {
+	ch       *amqp.Channel
+	confirms <-chan amqp.Confirmation
+	returns  <-chan amqp.Return
+
+	mu      sync.Mutex
+	nextTag uint64
+	pending map[uint64]*pendingPublish // Set to nil once the channel is closed
+}
+
+func newPublishChannel(ch *amqp.Channel) (*publishChannel, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	return &publishChannel{
+		ch:       ch,
+		confirms: ch.NotifyPublish(make(chan amqp.Confirmation, 1024)),
+		returns:  ch.NotifyReturn(make(chan amqp.Return, 1024)),
+		pending:  make(map[uint64]*pendingPublish),
+	}, nil
+}
+
+// Publish publishes msg as mandatory, so unroutable messages are returned instead of dropped
+// It blocks while the connection is being re-established; the returned channel receives
+// exactly one result once the broker confirms, nacks or returns the message
+// Messages still unconfirmed when the connection is lost are published again after reconnecting
+// msg.MessageId must be set, it correlates returns with their confirmation
+func (c *Connection) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) (<-chan PublishResult, error) {
+	if msg.MessageId == "" {
+		return nil, errors.New("message ID is required to track publisher confirms")
+	}
+
+	p := &pendingPublish{
+		ctx:      ctx,
+		exchange: exchange,
+		key:      key,
+		msg:      msg,
+		result:   make(chan PublishResult, 1),
+	}
+	if err := c.publish(p); err != nil {
+		return nil, err
+	}
+	return p.result, nil
+}
+
+// publish sends p on the current publishing channel, waiting for a connection if needed
+func (c *Connection) publish(p *pendingPublish) error {
+	for {
+		_, pub, err := c.waitConnected(p.ctx)
+		if err != nil {
+			return err
+		}
+
+		pub.mu.Lock()
+		if pub.pending == nil {
+			// The channel closed after waitConnected returned it, wait for the next one
+			pub.mu.Unlock()
+			continue
+		}
+
+		// Delivery tags start at 1 and only advance for messages actually sent
+		err = pub.ch.Publish(p.exchange, p.key, true, false, p.msg)
+		if err == nil {
+			pub.nextTag++
+			pub.pending[pub.nextTag] = p
+		}
+		pub.mu.Unlock()
+
+		if err == nil || !errors.Is(err, amqp.ErrClosed) {
+			return err
+		}
+	}
+}
+
+// republish publishes a message again after its channel closed before it was confirmed
+func (c *Connection) republish(p *pendingPublish) {
+	if err := c.publish(p); err != nil {
+		p.result <- PublishResult{MessageID: p.msg.MessageId, Err: err}
+	}
+}
+
+// trackConfirms resolves pending publishes as confirmations arrive until the channel closes
+// Unconfirmed messages are then handed to retry
+func (pc *publishChannel) trackConfirms(retry func(p *pendingPublish)) {
+	returned := make(map[string]amqp.Return)
+	returns := pc.returns
+
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			returned[r.MessageId] = r
+		case conf, ok := <-pc.confirms:
+			if !ok {
+				pc.mu.Lock()
+				unconfirmed := pc.pending
+				pc.pending = nil
+				pc.mu.Unlock()
+
+				for _, p := range unconfirmed {
+					go retry(p)
+				}
+				return
+			}
+
+			// The broker sends basic.return before the basic.ack of the same message,
+			// so any return for this confirmation is already buffered
+		drain:
+			for returns != nil {
+				select {
+				case r, ok := <-returns:
+					if !ok {
+						returns = nil
+						break drain
+					}
+					returned[r.MessageId] = r
+				default:
+					break drain
+				}
+			}
+
+			pc.mu.Lock()
+			p, ok := pc.pending[conf.DeliveryTag]
+			delete(pc.pending, conf.DeliveryTag)
+			pc.mu.Unlock()
+			if !ok {
+				continue
+			}
+
+			result := PublishResult{MessageID: p.msg.MessageId}
+			if r, ok := returned[p.msg.MessageId]; ok {
+				delete(returned, p.msg.MessageId)
+				result.Outcome = OutcomeReturned
+				result.Return = &r
+			} else if conf.Ack {
+				result.Outcome = OutcomeConfirmed
+			} else {
+				result.Outcome = OutcomeNacked
+			}
+			p.result <- result
+		}
+	}
+}
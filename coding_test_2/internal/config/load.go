@@ -0,0 +1,179 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CONFIG_FILE_ENV names the environment variable holding the config file path
+const CONFIG_FILE_ENV = "CONFIG_FILE"
+
+// Load resolves the configuration with the following precedence, highest first:
+// command line flags, environment variables, the config file, then Default()
+// The config file is given by the -config flag or CONFIG_FILE and may be YAML or JSON
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("report-processor", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(CONFIG_FILE_ENV), "Path to a YAML or JSON config file (env: "+CONFIG_FILE_ENV+")")
+
+	// Flags are collected as strings and applied after the file and environment
+	flagValues := make(map[string]*string)
+	eachField(cfg, func(f field) {
+		if f.flag == "" {
+			return
+		}
+		flagValues[f.flag] = fs.String(f.flag, f.String(), fmt.Sprintf("%s (env: %s)", f.usage, f.env))
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			return nil, err
+		}
+		cfg.file = *configFile
+	}
+
+	var errs []error
+	eachField(cfg, func(f field) {
+		if value, ok := os.LookupEnv(f.env); ok && f.env != "" {
+			if err := f.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("environment variable %s: %w", f.env, err))
+			}
+		}
+	})
+
+	fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == "config" {
+			return
+		}
+		eachField(cfg, func(f field) {
+			if f.flag == fl.Name {
+				if err := f.Set(*flagValues[fl.Name]); err != nil {
+					errs = append(errs, fmt.Errorf("flag -%s: %w", f.flag, err))
+				}
+			}
+		})
+	})
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the values found in a YAML or JSON file onto cfg
+// Unknown keys are rejected so typos do not go unnoticed
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// The decoder merges into maps, so the per type maps are cleared beforehand: a file setting
+	// them replaces the defaults entirely, a file leaving them out keeps the defaults
+	consumerTypes, priorityTypes := cfg.Consumer.Types, cfg.Priority.Types
+	cfg.Consumer.Types, cfg.Priority.Types = nil, nil
+
+	// JSON is a subset of YAML, so a single decoder handles both
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(cfg)
+	if cfg.Consumer.Types == nil {
+		cfg.Consumer.Types = consumerTypes
+	}
+	if cfg.Priority.Types == nil {
+		cfg.Priority.Types = priorityTypes
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// field is a configurable leaf value of Config along with its sources
+type field struct {
+	env   string
+	flag  string
+	usage string
+	value reflect.Value
+}
+
+// eachField calls fn for every field of cfg tagged with an env or flag name
+func eachField(cfg *Config, fn func(f field)) {
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			fv := v.Field(i)
+			if sf.Type.Kind() == reflect.Struct {
+				walk(fv)
+				continue
+			}
+			if sf.Tag.Get("env") == "" && sf.Tag.Get("flag") == "" {
+				continue
+			}
+			fn(field{
+				env:   sf.Tag.Get("env"),
+				flag:  sf.Tag.Get("flag"),
+				usage: sf.Tag.Get("usage"),
+				value: fv,
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem())
+}
+
+// String returns the current value formatted the way Set parses it
+func (f field) String() string {
+	if d, ok := f.value.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+// Set parses s according to the field's type
+func (f field) Set(s string) error {
+	switch f.value.Interface().(type) {
+	case string:
+		f.value.SetString(s)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", s)
+		}
+		f.value.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", s)
+		}
+		f.value.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("expected a duration such as 500ms or 5s, got %q", s)
+		}
+		f.value.SetInt(int64(d))
+	default:
+		return fmt.Errorf("unsupported config type %s", f.value.Type())
+	}
+	return nil
+}
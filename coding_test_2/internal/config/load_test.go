@@ -0,0 +1,165 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unsetEnv clears environment variables for the duration of the test
+func unsetEnv(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		t.Setenv(name, "") // Restores the original value after the test
+		os.Unsetenv(name)
+	}
+}
+
+// writeConfigFile writes a config file to a temporary directory and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := "consumer:\n  num_workers: 4\n  worker_timeout: 6s\n"
+	tests := []struct {
+		name        string
+		file        string
+		env         map[string]string
+		args        []string
+		wantWorkers int
+		wantTimeout time.Duration
+	}{
+		{"defaults", "", nil, nil, 3, 5 * time.Second},
+		{"file over defaults", file, nil, nil, 4, 6 * time.Second},
+		{"env over file", file, map[string]string{"NUM_WORKERS": "5"}, nil, 5, 6 * time.Second},
+		{"flag over env", file, map[string]string{"NUM_WORKERS": "5"}, []string{"-num-workers", "7"}, 7, 6 * time.Second},
+		{"flag over file", file, nil, []string{"-worker-timeout", "8s"}, 4, 8 * time.Second},
+		{"env without file", "", map[string]string{"WORKER_TIMEOUT": "9s"}, nil, 3, 9 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unsetEnv(t, CONFIG_FILE_ENV, "NUM_WORKERS", "WORKER_TIMEOUT")
+			t.Setenv("DOWNLOAD_SIGNING_KEY", "secret")
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			args := test.args
+			if test.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, test.file)}, args...)
+			}
+
+			cfg, err := Load(args)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if cfg.Consumer.NumWorkers != test.wantWorkers || cfg.Consumer.WorkerTimeout != test.wantTimeout {
+				t.Fatalf("got %d workers with timeout %s, want %d with %s",
+					cfg.Consumer.NumWorkers, cfg.Consumer.WorkerTimeout, test.wantWorkers, test.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	unsetEnv(t, "NUM_WORKERS")
+	t.Setenv("DOWNLOAD_SIGNING_KEY", "secret")
+	t.Setenv(CONFIG_FILE_ENV, writeConfigFile(t, "consumer:\n  num_workers: 4\n"))
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Consumer.NumWorkers != 4 || cfg.File() != os.Getenv(CONFIG_FILE_ENV) {
+		t.Fatalf("got %d workers from %q, want 4 from the file", cfg.Consumer.NumWorkers, cfg.File())
+	}
+}
+
+func TestLoadJoinsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want []string
+	}{
+		{
+			"parse errors",
+			map[string]string{"NUM_WORKERS": "many", "DOWNLOAD_SIGNING_KEY": "secret"},
+			[]string{"-worker-timeout", "5", "-tracing-enabled", "maybe"},
+			[]string{"environment variable NUM_WORKERS", "flag -worker-timeout", "flag -tracing-enabled"},
+		},
+		{
+			"validation errors",
+			nil,
+			[]string{"-redis-url", "", "-num-workers", "0", "-max-priority", "300"},
+			[]string{"http.download_signing_key: must be set", "redis.addr", "consumer.num_workers", "priority.max"},
+		},
+		{
+			"placeholder signing key",
+			map[string]string{"DOWNLOAD_SIGNING_KEY": placeholderSigningKey},
+			nil,
+			[]string{"http.download_signing_key: must not be the example placeholder"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unsetEnv(t, CONFIG_FILE_ENV, "NUM_WORKERS", "DOWNLOAD_SIGNING_KEY")
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := Load(test.args)
+			if err == nil {
+				t.Fatal("load succeeded, want an error")
+			}
+			for _, want := range test.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFileReplacesTypeMaps(t *testing.T) {
+	unsetEnv(t, CONFIG_FILE_ENV)
+	t.Setenv("DOWNLOAD_SIGNING_KEY", "secret")
+
+	// Types left out of the file lose their built-in settings
+	path := writeConfigFile(t, "consumer:\n  types:\n    sales:\n      num_workers: 2\npriority:\n  types:\n    sales: 3\n")
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if _, ok := cfg.Consumer.Types["financial"]; ok || cfg.Consumer.Types["sales"].NumWorkers != 2 {
+		t.Fatalf("got consumer types %v, want only sales", cfg.Consumer.Types)
+	}
+	if _, ok := cfg.Priority.Types["financial"]; ok || cfg.Priority.Types["sales"] != 3 {
+		t.Fatalf("got priority types %v, want only sales", cfg.Priority.Types)
+	}
+
+	// An empty map removes every built-in entry
+	cfg, err = Load([]string{"-config", writeConfigFile(t, "consumer:\n  types: {}\n")})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cfg.Consumer.Types) != 0 {
+		t.Fatalf("got consumer types %v, want none", cfg.Consumer.Types)
+	}
+
+	// A file without the maps keeps the built-in ones
+	cfg, err = Load([]string{"-config", writeConfigFile(t, "consumer:\n  num_workers: 4\n")})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Consumer.Types["financial"].NumWorkers != 1 || cfg.Priority.Types["financial"] != 1 {
+		t.Fatalf("got consumer types %v and priority types %v, want the defaults", cfg.Consumer.Types, cfg.Priority.Types)
+	}
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// placeholderSigningKey is the download signing key of the example configuration
+const placeholderSigningKey = "change-me"
+
+// Validate checks the configuration and reports every invalid value at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, name string, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	if u, err := url.Parse(c.RabbitMQ.URL); err != nil || (u.Scheme != "amqp" && u.Scheme != "amqps") {
+		check(false, "rabbitmq.url", "must be an amqp:// or amqps:// URL, got %q", c.RabbitMQ.URL)
+	}
+	check(c.RabbitMQ.Exchange != "", "rabbitmq.exchange", "must not be empty")
+	check(c.RabbitMQ.QueueName != "", "rabbitmq.queue_name", "must not be empty")
+	checkPositive(check, "rabbitmq.reconnect_initial_backoff", c.RabbitMQ.ReconnectInitialBackoff)
+	check(c.RabbitMQ.ReconnectMaxBackoff >= c.RabbitMQ.ReconnectInitialBackoff, "rabbitmq.reconnect_max_backoff",
+		"must not be less than rabbitmq.reconnect_initial_backoff (%s), got %s", c.RabbitMQ.ReconnectInitialBackoff, c.RabbitMQ.ReconnectMaxBackoff)
+
+	check(c.Redis.Addr != "", "redis.addr", "must not be empty")
+	check(c.Redis.DB >= 0, "redis.db", "must not be negative, got %d", c.Redis.DB)
+
+	check(c.HTTP.Addr != "", "http.addr", "must not be empty")
+	if u, err := url.Parse(c.HTTP.PublicBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		check(false, "http.public_base_url", "must be an absolute URL, got %q", c.HTTP.PublicBaseURL)
+	}
+	// Anyone knowing the key can forge download URLs, there is no default
+	check(c.HTTP.DownloadSigningKey != "", "http.download_signing_key", "must be set")
+	check(c.HTTP.DownloadSigningKey != placeholderSigningKey, "http.download_signing_key", "must not be the example placeholder %q", placeholderSigningKey)
+	checkPositive(check, "http.download_url_expiry", c.HTTP.DownloadURLExpiry)
+
+	check(c.Producer.NumRequests >= 0, "producer.num_requests", "must not be negative, got %d", c.Producer.NumRequests)
+	check(c.Producer.PublishInterval >= 0, "producer.publish_interval", "must not be negative, got %s", c.Producer.PublishInterval)
+	check(c.Producer.ConfirmTimeout >= 0, "producer.confirm_timeout", "must not be negative, got %s", c.Producer.ConfirmTimeout)
+
+	check(c.Consumer.NumWorkers >= 1, "consumer.num_workers", "must be at least 1, got %d", c.Consumer.NumWorkers)
+	checkPositive(check, "consumer.worker_timeout", c.Consumer.WorkerTimeout)
+	check(c.Consumer.ClaimLease > c.Consumer.WorkerTimeout, "consumer.claim_lease",
+		"must be greater than consumer.worker_timeout (%s), got %s", c.Consumer.WorkerTimeout, c.Consumer.ClaimLease)
+	checkPositive(check, "consumer.drain_timeout", c.Consumer.DrainTimeout)
+	check(c.Consumer.MaxUnsupportedRequeues >= 0, "consumer.max_unsupported_requeues", "must not be negative, got %d", c.Consumer.MaxUnsupportedRequeues)
+	for reportType, pool := range c.Consumer.Types {
+		name := "consumer.types." + reportType
+		check(pool.NumWorkers >= 0, name+".num_workers", "must not be negative, got %d", pool.NumWorkers)
+		check(pool.WorkerTimeout >= 0, name+".worker_timeout", "must not be negative, got %s", pool.WorkerTimeout)
+		check(pool.Prefetch >= 0, name+".prefetch", "must not be negative, got %d", pool.Prefetch)
+		if timeout := c.Consumer.ForType(reportType).WorkerTimeout; timeout >= c.Consumer.ClaimLease {
+			check(false, name+".worker_timeout", "must be less than consumer.claim_lease (%s), got %s", c.Consumer.ClaimLease, timeout)
+		}
+	}
+
+	check(c.Outbox.BatchSize >= 1, "outbox.batch_size", "must be at least 1, got %d", c.Outbox.BatchSize)
+	checkPositive(check, "outbox.poll_interval", c.Outbox.PollInterval)
+	checkPositive(check, "outbox.claim_idle", c.Outbox.ClaimIdle)
+	check(c.Outbox.MaxDeliveries >= 1, "outbox.max_deliveries", "must be at least 1, got %d", c.Outbox.MaxDeliveries)
+
+	check(c.Priority.Max >= 1 && c.Priority.Max <= 255, "priority.max", "must be between 1 and 255, got %d", c.Priority.Max)
+	check(c.Priority.Default >= 1 && c.Priority.Default <= c.Priority.Max, "priority.default",
+		"must be between 1 and priority.max (%d), got %d", c.Priority.Max, c.Priority.Default)
+	for reportType, priority := range c.Priority.Types {
+		check(priority >= 1 && priority <= c.Priority.Max, "priority.types."+reportType,
+			"must be between 1 and priority.max (%d), got %d", c.Priority.Max, priority)
+	}
+
+	checkPositive(check, "scheduler.poll_interval", c.Scheduler.PollInterval)
+	check(c.Scheduler.LeaderLease > c.Scheduler.PollInterval, "scheduler.leader_lease",
+		"must be greater than scheduler.poll_interval (%s), got %s", c.Scheduler.PollInterval, c.Scheduler.LeaderLease)
+
+	checkPositive(check, "recovery.heartbeat_interval", c.Recovery.HeartbeatInterval)
+	check(c.Recovery.HeartbeatInterval < c.Consumer.ClaimLease, "recovery.heartbeat_interval",
+		"must be less than consumer.claim_lease (%s), got %s", c.Consumer.ClaimLease, c.Recovery.HeartbeatInterval)
+	checkPositive(check, "recovery.reap_interval", c.Recovery.ReapInterval)
+	check(c.Recovery.MaxAttempts >= 1, "recovery.max_attempts", "must be at least 1, got %d", c.Recovery.MaxAttempts)
+	checkPositive(check, "recovery.redelivery_timeout", c.Recovery.RedeliveryTimeout)
+
+	check(c.Tenants.MaxConcurrent >= 0, "tenants.max_concurrent", "must not be negative, got %d", c.Tenants.MaxConcurrent)
+	check(c.Tenants.Weight >= 1, "tenants.weight", "must be at least 1, got %d", c.Tenants.Weight)
+	check(c.Tenants.SlotLease > c.Consumer.ClaimLease, "tenants.slot_lease",
+		"must be greater than consumer.claim_lease (%s), got %s", c.Consumer.ClaimLease, c.Tenants.SlotLease)
+	for tenantID, tenant := range c.Tenants.Overrides {
+		check(tenant.MaxConcurrent >= 0, "tenants.overrides."+tenantID+".max_concurrent", "must not be negative, got %d", tenant.MaxConcurrent)
+		check(tenant.Weight >= 0, "tenants.overrides."+tenantID+".weight", "must not be negative, got %d", tenant.Weight)
+	}
+
+	check(c.RateLimit.Rate >= 0, "rate_limit.rate", "must not be negative, got %d", c.RateLimit.Rate)
+	if c.RateLimit.Rate > 0 {
+		checkPositive(check, "rate_limit.period", c.RateLimit.Period)
+		check(c.RateLimit.Burst >= 1, "rate_limit.burst", "must be at least 1, got %d", c.RateLimit.Burst)
+	}
+	check(c.RateLimit.DailyQuota >= 0, "rate_limit.daily_quota", "must not be negative, got %d", c.RateLimit.DailyQuota)
+
+	checkPositive(check, "webhook.timeout", c.Webhook.Timeout)
+	check(c.Webhook.MaxAttempts >= 1, "webhook.max_attempts", "must be at least 1, got %d", c.Webhook.MaxAttempts)
+	checkPositive(check, "webhook.initial_backoff", c.Webhook.InitialBackoff)
+	check(c.Webhook.MaxBackoff >= c.Webhook.InitialBackoff, "webhook.max_backoff",
+		"must not be less than webhook.initial_backoff (%s), got %s", c.Webhook.InitialBackoff, c.Webhook.MaxBackoff)
+
+	switch c.Storage.Backend {
+	case "filesystem":
+		check(c.Storage.Dir != "", "storage.dir", "must not be empty when storage.backend is filesystem")
+	case "s3":
+		check(c.Storage.S3.Endpoint != "", "storage.s3.endpoint", "must not be empty when storage.backend is s3")
+		check(c.Storage.S3.Bucket != "", "storage.s3.bucket", "must not be empty when storage.backend is s3")
+	default:
+		check(false, "storage.backend", "must be filesystem or s3, got %q", c.Storage.Backend)
+	}
+
+	if c.Tracing.Enabled {
+		check(c.Tracing.Endpoint != "", "tracing.endpoint", "must not be empty when tracing is enabled")
+		check(c.Tracing.ServiceName != "", "tracing.service_name", "must not be empty when tracing is enabled")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// checkPositive reports durations that are zero or negative
+func checkPositive(check func(bool, string, string, ...interface{}), name string, d time.Duration) {
+	check(d > 0, name, "must be a positive duration, got %s", d)
+}
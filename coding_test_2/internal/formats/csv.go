@@ -0,0 +1,21 @@
+package formats
+
+import (
+	"bytes"
+	"coding_test_2/internal/models"
+	"encoding/csv"
+)
+
+// renderCSV writes the columns as a header row followed by the table rows
+func renderCSV(table *models.ReportTable) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write(table.Columns); err != nil {
+		return nil, err
+	}
+	if err := w.WriteAll(table.Rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,67 @@
+package formats
+
+import (
+	"coding_test_2/internal/models"
+	"fmt"
+	"strings"
+)
+
+// DefaultFormat is used when a request does not specify a "format" parameter
+const DefaultFormat = models.FormatJSON
+
+// renderer renders a report table into a single output format
+type renderer struct {
+	contentType string
+	binary      bool
+	render      func(table *models.ReportTable) ([]byte, error)
+}
+
+var renderers = map[models.ReportFormat]renderer{
+	models.FormatCSV:  {contentType: "text/csv", render: renderCSV},
+	models.FormatJSON: {contentType: "application/json", render: renderJSON},
+	models.FormatXLSX: {contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", binary: true, render: renderXLSX},
+	models.FormatPDF:  {contentType: "application/pdf", binary: true, render: renderPDF},
+}
+
+// Parse returns the ReportFormat for a "format" parameter value, which is case-insensitive
+// An empty value resolves to DefaultFormat
+func Parse(value string) (models.ReportFormat, error) {
+	if value == "" {
+		return DefaultFormat, nil
+	}
+
+	format := models.ReportFormat(strings.ToUpper(value))
+	if _, ok := renderers[format]; !ok {
+		return "", fmt.Errorf("format must be one of %v, got %q", Supported(), value)
+	}
+	return format, nil
+}
+
+// Supported returns the supported output formats
+func Supported() []models.ReportFormat {
+	return []models.ReportFormat{models.FormatCSV, models.FormatJSON, models.FormatXLSX, models.FormatPDF}
+}
+
+// IsBinary reports whether the format's content is not plain text
+func IsBinary(format models.ReportFormat) bool {
+	return renderers[format].binary
+}
+
+// Render renders table in the given format
+func Render(format models.ReportFormat, table *models.ReportTable) (*models.ReportArtifact, error) {
+	r, ok := renderers[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+
+	data, err := r.render(table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", format, err)
+	}
+
+	return &models.ReportArtifact{
+		Format:      format,
+		ContentType: r.contentType,
+		Data:        data,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package formats
+
+import (
+	"coding_test_2/internal/models"
+	"encoding/json"
+	"time"
+)
+
+// jsonReport is the JSON representation of a report table, with rows keyed by column
+type jsonReport struct {
+	Title       string              `json:"title"`
+	GeneratedAt time.Time           `json:"generated_at"`
+	Columns     []string            `json:"columns"`
+	Rows        []map[string]string `json:"rows"`
+}
+
+func renderJSON(table *models.ReportTable) ([]byte, error) {
+	report := jsonReport{
+		Title:       table.Title,
+		GeneratedAt: table.GeneratedAt,
+		Columns:     table.Columns,
+		Rows:        make([]map[string]string, 0, len(table.Rows)),
+	}
+
+	for _, row := range table.Rows {
+		record := make(map[string]string, len(table.Columns))
+		for i, column := range table.Columns {
+			if i < len(row) {
+				record[column] = row[i]
+			}
+		}
+		report.Rows = append(report.Rows, record)
+	}
+
+	return json.Marshal(report)
+}
@@ -0,0 +1,142 @@
+package formats
+
+import (
+	"bytes"
+	"coding_test_2/internal/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PDF page layout, in points, for an A4 portrait page using a monospaced font
+const (
+	pdfPageWidth    = 595
+	pdfPageHeight   = 842
+	pdfMargin       = 50
+	pdfFontSize     = 9
+	pdfLineHeight   = 12
+	pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+	pdfMaxLineChars = 90 // Courier 9pt fits ~90 characters between the margins
+)
+
+// renderPDF lays the table out as fixed-width text and writes a minimal PDF 1.4 document
+func renderPDF(table *models.ReportTable) ([]byte, error) {
+	lines := pdfLines(table)
+
+	var pages [][]string
+	for len(lines) > 0 {
+		n := min(pdfLinesPerPage, len(lines))
+		pages = append(pages, lines[:n])
+		lines = lines[n:]
+	}
+
+	// Object layout: 1 catalog, 2 page tree, 3 font, then a page and a content stream per page
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>")
+
+	for i, pageLines := range pages {
+		objects = append(objects, fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 5+2*i))
+
+		stream := pdfContentStream(pageLines)
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xrefOffset := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+
+	return buf.Bytes(), nil
+}
+
+// pdfLines renders the title and the table as padded, fixed-width text lines
+func pdfLines(table *models.ReportTable) []string {
+	widths := make([]int, len(table.Columns))
+	for i, column := range table.Columns {
+		widths[i] = len(column)
+	}
+	for _, row := range table.Rows {
+		for i, cell := range row {
+			if i < len(widths) && len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	formatRow := func(cells []string) string {
+		padded := make([]string, len(widths))
+		for i := range widths {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			padded[i] = fmt.Sprintf("%-*s", widths[i], cell)
+		}
+		line := strings.TrimRight(strings.Join(padded, "  "), " ")
+		if len(line) > pdfMaxLineChars {
+			line = line[:pdfMaxLineChars]
+		}
+		return line
+	}
+
+	header := formatRow(table.Columns)
+	lines := []string{
+		table.Title,
+		"Generated On: " + table.GeneratedAt.Format(time.RFC3339),
+		"",
+		header,
+		strings.Repeat("-", len(header)),
+	}
+	for _, row := range table.Rows {
+		lines = append(lines, formatRow(row))
+	}
+	return lines
+}
+
+// pdfContentStream draws the lines top to bottom starting at the top margin
+func pdfContentStream(lines []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin)
+	for _, line := range lines {
+		fmt.Fprintf(&sb, "(%s) Tj T*\n", pdfEscape(line))
+	}
+	sb.WriteString("ET")
+	return sb.String()
+}
+
+// pdfEscape escapes a string for use in a PDF literal string, replacing non-ASCII characters
+func pdfEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case r < 32 || r > 126:
+			sb.WriteRune('?')
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
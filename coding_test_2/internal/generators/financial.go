@@ -0,0 +1,64 @@
+package generators
+
+import (
+	"coding_test_2/internal/models"
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// FinancialGenerator produces an income statement over a date range
+// Parameters: start_date, end_date (required), currency (optional, defaults to IDR)
+type FinancialGenerator struct{}
+
+func (g *FinancialGenerator) Type() string {
+	return "financial"
+}
+
+func (g *FinancialGenerator) Validate(params map[string]string) error {
+	if _, _, err := parseDateRange(params, true); err != nil {
+		return err
+	}
+	return oneOf(params, "currency", "IDR", "USD", "SGD")
+}
+
+func (g *FinancialGenerator) Generate(ctx context.Context, request models.ReportRequest) (*models.ReportTable, error) {
+	// Financial reports are the heaviest to produce
+	if err := simulateWork(ctx, request.ID, 2*time.Second, 5*time.Second); err != nil {
+		return nil, err
+	}
+
+	start, end, _ := parseDateRange(request.Parameters, true)
+	currency := request.Parameters["currency"]
+	if currency == "" {
+		currency = "IDR"
+	}
+
+	revenue := 10000 + rand.Float64()*90000
+	costOfSales := revenue * (0.3 + rand.Float64()*0.2)
+	operatingExpenses := revenue * (0.1 + rand.Float64()*0.2)
+	grossProfit := revenue - costOfSales
+	netIncome := grossProfit - operatingExpenses
+
+	table := &models.ReportTable{
+		Title:       fmt.Sprintf("Financial Report %s (%s to %s)", request.ID, start.Format(dateLayout), end.Format(dateLayout)),
+		Columns:     []string{"line_item", "currency", "amount"},
+		GeneratedAt: time.Now().UTC(),
+	}
+	for _, item := range []struct {
+		name   string
+		amount float64
+	}{
+		{"revenue", revenue},
+		{"cost_of_sales", costOfSales},
+		{"gross_profit", grossProfit},
+		{"operating_expenses", operatingExpenses},
+		{"net_income", netIncome},
+	} {
+		table.Rows = append(table.Rows, []string{item.name, currency, strconv.FormatFloat(item.amount, 'f', 2, 64)})
+	}
+
+	return table, nil
+}
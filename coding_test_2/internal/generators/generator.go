@@ -0,0 +1,153 @@
+package generators
+
+import (
+	"coding_test_2/internal/formats"
+	"coding_test_2/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrUnknownReportType is returned for report types without a registered generator
+	ErrUnknownReportType = errors.New("unknown report type")
+	// ErrInvalidParameters is returned when a request's parameters fail validation
+	ErrInvalidParameters = errors.New("invalid report parameters")
+)
+
+// PermanentError marks a failure that will not succeed on retry (e.g. bad input)
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err as a PermanentError
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err, or any error it wraps, is a PermanentError
+func IsPermanent(err error) bool {
+	var permanentErr *PermanentError
+	return errors.As(err, &permanentErr)
+}
+
+// ReportGenerator generates a single report type
+type ReportGenerator interface {
+	// Type returns the ReportType handled by the generator, e.g. "sales"
+	Type() string
+	// Validate checks the request parameters before any work is done
+	Validate(params map[string]string) error
+	// Generate produces the report content, respecting ctx for timeout/cancellation
+	Generate(ctx context.Context, request models.ReportRequest) (*models.ReportTable, error)
+}
+
+// Registry maps report types to their generator
+type Registry struct {
+	generators map[string]ReportGenerator
+}
+
+func NewRegistry(generators ...ReportGenerator) *Registry {
+	r := &Registry{
+		generators: make(map[string]ReportGenerator),
+	}
+	for _, g := range generators {
+		r.Register(g)
+	}
+	return r
+}
+
+// NewDefaultRegistry returns a registry with every built-in report generator
+func NewDefaultRegistry() *Registry {
+	return NewRegistry(
+		&SalesGenerator{},
+		&InventoryGenerator{},
+		&FinancialGenerator{},
+		&UserActivityGenerator{},
+	)
+}
+
+// Register adds a generator, replacing any generator of the same type
+func (r *Registry) Register(g ReportGenerator) {
+	r.generators[g.Type()] = g
+}
+
+// Get returns the generator for reportType
+func (r *Registry) Get(reportType string) (ReportGenerator, error) {
+	g, ok := r.generators[reportType]
+	if !ok {
+		return nil, Permanent(fmt.Errorf("%w: %q", ErrUnknownReportType, reportType))
+	}
+	return g, nil
+}
+
+// Types returns the registered report types in sorted order
+func (r *Registry) Types() []string {
+	types := make([]string, 0, len(r.generators))
+	for t := range r.generators {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Validate checks that the request has a known type, a supported format and valid parameters
+// The returned error is always permanent
+func (r *Registry) Validate(request models.ReportRequest) error {
+	g, err := r.Get(request.ReportType)
+	if err != nil {
+		return err
+	}
+	if _, err := formats.Parse(request.Parameters["format"]); err != nil {
+		return Permanent(fmt.Errorf("%w: %v", ErrInvalidParameters, err))
+	}
+	if err := g.Validate(request.Parameters); err != nil {
+		return Permanent(fmt.Errorf("%w: %v", ErrInvalidParameters, err))
+	}
+	return nil
+}
+
+// Generate validates the request, runs the generator for its type and renders
+// the result in the requested format
+func (r *Registry) Generate(ctx context.Context, request models.ReportRequest) (*models.ReportArtifact, error) {
+	if err := r.Validate(request); err != nil {
+		return nil, err
+	}
+
+	g, _ := r.Get(request.ReportType)
+	table, err := g.Generate(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	format, _ := formats.Parse(request.Parameters["format"])
+	return formats.Render(format, table)
+}
+
+// simulateWork waits for a random duration in [min, max] and fails transiently 20% of the time
+// It stands in for CPU-intensive work or external API calls
+func simulateWork(ctx context.Context, requestID string, min, max time.Duration) error {
+	delay := min + time.Duration(rand.Int63n(int64(max-min)+1))
+	select {
+	case <-time.After(delay):
+		// Continue processing
+	case <-ctx.Done():
+		return ctx.Err() // Propagate context cancellation error
+	}
+
+	// Simulate random failure (e.g., database error)
+	if rand.Intn(100) < 20 { // 20% chance of failure
+		return fmt.Errorf("simulated report generation error for ID %s", requestID)
+	}
+	return nil
+}
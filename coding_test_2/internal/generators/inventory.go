@@ -0,0 +1,52 @@
+package generators
+
+import (
+	"coding_test_2/internal/models"
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// InventoryGenerator reports stock levels per SKU, optionally for a single warehouse
+// Parameters: start_date, end_date, warehouse (all optional)
+type InventoryGenerator struct{}
+
+func (g *InventoryGenerator) Type() string {
+	return "inventory"
+}
+
+func (g *InventoryGenerator) Validate(params map[string]string) error {
+	_, _, err := parseDateRange(params, false)
+	return err
+}
+
+func (g *InventoryGenerator) Generate(ctx context.Context, request models.ReportRequest) (*models.ReportTable, error) {
+	if err := simulateWork(ctx, request.ID, 1*time.Second, 2*time.Second); err != nil {
+		return nil, err
+	}
+
+	warehouse := request.Parameters["warehouse"]
+	if warehouse == "" {
+		warehouse = "all"
+	}
+
+	table := &models.ReportTable{
+		Title:       fmt.Sprintf("Inventory Report %s (warehouse: %s)", request.ID, warehouse),
+		Columns:     []string{"sku", "warehouse", "on_hand", "reorder_level", "low_stock"},
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	skus := 10 + rand.Intn(40)
+	for i := 1; i <= skus; i++ {
+		onHand := rand.Intn(500)
+		reorderLevel := 50 + rand.Intn(50)
+		table.Rows = append(table.Rows, []string{
+			fmt.Sprintf("SKU-%04d", i), warehouse, strconv.Itoa(onHand), strconv.Itoa(reorderLevel),
+			strconv.FormatBool(onHand < reorderLevel),
+		})
+	}
+
+	return table, nil
+}
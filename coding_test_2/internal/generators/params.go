@@ -0,0 +1,69 @@
+package generators
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// dateLayout is the layout of date parameters, e.g. "2024-01-31"
+	dateLayout = "2006-01-02"
+	// maxReportDays bounds the number of daily rows a report can contain
+	maxReportDays = 366
+)
+
+// parseDate parses the named date parameter, returning the zero time if it is absent and optional
+func parseDate(params map[string]string, name string, required bool) (time.Time, error) {
+	value, ok := params[name]
+	if !ok || value == "" {
+		if required {
+			return time.Time{}, fmt.Errorf("missing %s", name)
+		}
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a date formatted as YYYY-MM-DD, got %q", name, value)
+	}
+	return t, nil
+}
+
+// parseDateRange parses start_date and end_date, ensuring start_date is not after end_date
+func parseDateRange(params map[string]string, required bool) (time.Time, time.Time, error) {
+	start, err := parseDate(params, "start_date", required)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parseDate(params, "end_date", required)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if !start.IsZero() && !end.IsZero() && start.After(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("start_date %s is after end_date %s",
+			start.Format(dateLayout), end.Format(dateLayout))
+	}
+	return start, end, nil
+}
+
+// oneOf ensures the named parameter, if present, is one of the allowed values
+func oneOf(params map[string]string, name string, allowed ...string) error {
+	value, ok := params[name]
+	if !ok {
+		return nil
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be one of %v, got %q", name, allowed, value)
+}
+
+// eachDay calls fn for every day from start to end inclusive, capped at maxReportDays days
+func eachDay(start, end time.Time, fn func(day time.Time)) {
+	for i, day := 0, start; !day.After(end) && i < maxReportDays; i, day = i+1, day.AddDate(0, 0, 1) {
+		fn(day)
+	}
+}
@@ -0,0 +1,51 @@
+package generators
+
+import (
+	"coding_test_2/internal/models"
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// SalesGenerator summarizes daily orders and revenue over a date range
+// Parameters: start_date, end_date (required), region (optional)
+type SalesGenerator struct{}
+
+func (g *SalesGenerator) Type() string {
+	return "sales"
+}
+
+func (g *SalesGenerator) Validate(params map[string]string) error {
+	_, _, err := parseDateRange(params, true)
+	return err
+}
+
+func (g *SalesGenerator) Generate(ctx context.Context, request models.ReportRequest) (*models.ReportTable, error) {
+	if err := simulateWork(ctx, request.ID, 1*time.Second, 3*time.Second); err != nil {
+		return nil, err
+	}
+
+	start, end, _ := parseDateRange(request.Parameters, true)
+	region := request.Parameters["region"]
+	if region == "" {
+		region = "all"
+	}
+
+	table := &models.ReportTable{
+		Title:       fmt.Sprintf("Sales Report %s (%s to %s)", request.ID, start.Format(dateLayout), end.Format(dateLayout)),
+		Columns:     []string{"date", "region", "orders", "revenue"},
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	eachDay(start, end, func(day time.Time) {
+		orders := 10 + rand.Intn(90)
+		revenue := float64(orders) * (20 + rand.Float64()*80)
+		table.Rows = append(table.Rows, []string{
+			day.Format(dateLayout), region, strconv.Itoa(orders), strconv.FormatFloat(revenue, 'f', 2, 64),
+		})
+	})
+
+	return table, nil
+}
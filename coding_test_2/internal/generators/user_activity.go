@@ -0,0 +1,53 @@
+package generators
+
+import (
+	"coding_test_2/internal/models"
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// UserActivityGenerator reports daily active users and sessions over a date range
+// Parameters: start_date, end_date (required), segment (optional)
+type UserActivityGenerator struct{}
+
+func (g *UserActivityGenerator) Type() string {
+	return "user_activity"
+}
+
+func (g *UserActivityGenerator) Validate(params map[string]string) error {
+	if _, _, err := parseDateRange(params, true); err != nil {
+		return err
+	}
+	return oneOf(params, "segment", "all", "new", "returning")
+}
+
+func (g *UserActivityGenerator) Generate(ctx context.Context, request models.ReportRequest) (*models.ReportTable, error) {
+	if err := simulateWork(ctx, request.ID, 1*time.Second, 4*time.Second); err != nil {
+		return nil, err
+	}
+
+	start, end, _ := parseDateRange(request.Parameters, true)
+	segment := request.Parameters["segment"]
+	if segment == "" {
+		segment = "all"
+	}
+
+	table := &models.ReportTable{
+		Title:       fmt.Sprintf("User Activity Report %s (%s to %s)", request.ID, start.Format(dateLayout), end.Format(dateLayout)),
+		Columns:     []string{"date", "segment", "active_users", "sessions"},
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	eachDay(start, end, func(day time.Time) {
+		activeUsers := 100 + rand.Intn(900)
+		sessions := activeUsers * (1 + rand.Intn(5))
+		table.Rows = append(table.Rows, []string{
+			day.Format(dateLayout), segment, strconv.Itoa(activeUsers), strconv.Itoa(sessions),
+		})
+	})
+
+	return table, nil
+}
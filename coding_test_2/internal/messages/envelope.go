@@ -0,0 +1,171 @@
+package messages
+
+import (
+	"coding_test_2/internal/models"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// CurrentSchemaVersion is the version of the envelopes published
+// Version 1 is the bare ReportRequest published before envelopes were introduced
+const CurrentSchemaVersion = 2
+
+var (
+	// ErrInvalidMessage is returned for messages failing their schema, they never will pass it
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrUnsupportedVersion is returned for schema versions newer than this consumer knows
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// schemas holds the JSON schema of every version, loaded from schemaFiles
+var schemas = mustLoadSchemas()
+
+// upcasters convert a message of the version they are registered for into the next version
+var upcasters = map[int]func(body []byte) ([]byte, error){
+	1: upcastV1,
+}
+
+func mustLoadSchemas() map[int]*gojsonschema.Schema {
+	loaded := make(map[int]*gojsonschema.Schema)
+	for version := 1; version <= CurrentSchemaVersion; version++ {
+		data, err := schemaFiles.ReadFile(fmt.Sprintf("schemas/report_request.v%d.json", version))
+		if err != nil {
+			panic(fmt.Sprintf("missing schema of version %d: %v", version, err))
+		}
+		schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(data))
+		if err != nil {
+			panic(fmt.Sprintf("invalid schema of version %d: %v", version, err))
+		}
+		loaded[version] = schema
+	}
+	return loaded
+}
+
+type correlationKey struct{}
+
+// WithCorrelationID returns ctx carrying the correlation ID of the messages encoded with it
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, correlationID)
+}
+
+// EncodeReportRequest wraps a request in an envelope of the current schema version
+// The correlation ID is taken from ctx, the request ID is used if it carries none
+func EncodeReportRequest(ctx context.Context, request models.ReportRequest) ([]byte, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request %s: %w", request.ID, err)
+	}
+
+	correlationID, _ := ctx.Value(correlationKey{}).(string)
+	if correlationID == "" {
+		correlationID = request.ID
+	}
+
+	body, err := json.Marshal(models.Envelope{
+		SchemaVersion: CurrentSchemaVersion,
+		MessageType:   models.MessageTypeReportRequest,
+		MessageID:     uuid.NewString(),
+		CorrelationID: correlationID,
+		Timestamp:     time.Now().UTC(),
+		Payload:       payload,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal envelope of request %s: %w", request.ID, err)
+	}
+	return body, nil
+}
+
+// DecodeReportRequest validates a message against the schema of its version, upcasts it to
+// the current version and returns the envelope along with the request it carries
+// Messages without schema_version are version 1; invalid messages, including versions below 1,
+// fail with ErrInvalidMessage and versions newer than CurrentSchemaVersion with ErrUnsupportedVersion
+func DecodeReportRequest(body []byte) (*models.Envelope, *models.ReportRequest, error) {
+	var header struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(body, &header); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	version := 1
+	if header.SchemaVersion != nil {
+		version = *header.SchemaVersion
+	}
+	if version < 1 {
+		return nil, nil, fmt.Errorf("%w: schema version %d", ErrInvalidMessage, version)
+	}
+	if version > CurrentSchemaVersion {
+		return nil, nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	for ; version < CurrentSchemaVersion; version++ {
+		if err := validate(version, body); err != nil {
+			return nil, nil, err
+		}
+		upcast, err := upcasters[version](body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to upcast from version %d: %v", ErrInvalidMessage, version, err)
+		}
+		body = upcast
+	}
+	if err := validate(CurrentSchemaVersion, body); err != nil {
+		return nil, nil, err
+	}
+
+	var envelope models.Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	var request models.ReportRequest
+	if err := json.Unmarshal(envelope.Payload, &request); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	return &envelope, &request, nil
+}
+
+// validate checks body against the schema of a version
+func validate(version int, body []byte) error {
+	result, err := schemas[version].Validate(gojsonschema.NewBytesLoader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	if !result.Valid() {
+		problems := make([]string, 0, len(result.Errors()))
+		for _, problem := range result.Errors() {
+			problems = append(problems, problem.String())
+		}
+		return fmt.Errorf("%w: version %d: %s", ErrInvalidMessage, version, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// upcastV1 wraps a bare request in an envelope, identified and timed after the request
+func upcastV1(body []byte) ([]byte, error) {
+	var request models.ReportRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+
+	timestamp := request.CreatedAt.UTC()
+	if request.CreatedAt.IsZero() {
+		timestamp = time.Now().UTC()
+	}
+	return json.Marshal(models.Envelope{
+		SchemaVersion: 2,
+		MessageType:   models.MessageTypeReportRequest,
+		MessageID:     request.ID,
+		CorrelationID: request.ID,
+		Timestamp:     timestamp,
+		Payload:       json.RawMessage(body),
+	})
+}
@@ -0,0 +1,113 @@
+package messages
+
+import (
+	"coding_test_2/internal/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodeReportRequestV2(t *testing.T) {
+	request := models.ReportRequest{
+		ID:         "report-1",
+		TenantID:   "merchant-1",
+		ReportType: "sales",
+		Parameters: map[string]string{"format": "CSV"},
+		Priority:   3,
+		CreatedAt:  time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	body, err := EncodeReportRequest(WithCorrelationID(context.Background(), "call-1"), request)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	envelope, decoded, err := DecodeReportRequest(body)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if envelope.SchemaVersion != CurrentSchemaVersion || envelope.MessageType != models.MessageTypeReportRequest {
+		t.Fatalf("got version %d of %q, want %d of %q", envelope.SchemaVersion, envelope.MessageType, CurrentSchemaVersion, models.MessageTypeReportRequest)
+	}
+	if envelope.MessageID == "" || envelope.MessageID == request.ID {
+		t.Fatalf("got message ID %q, want a generated one", envelope.MessageID)
+	}
+	if envelope.CorrelationID != "call-1" {
+		t.Fatalf("got correlation ID %q, want call-1", envelope.CorrelationID)
+	}
+	if decoded.ID != request.ID || decoded.TenantID != request.TenantID || decoded.ReportType != request.ReportType ||
+		decoded.Priority != request.Priority || decoded.Parameters["format"] != "CSV" || !decoded.CreatedAt.Equal(request.CreatedAt) {
+		t.Fatalf("got %+v, want %+v", *decoded, request)
+	}
+}
+
+func TestEncodeReportRequestDefaultsCorrelationID(t *testing.T) {
+	body, err := EncodeReportRequest(context.Background(), models.ReportRequest{ID: "report-1", ReportType: "sales"})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	envelope, _, err := DecodeReportRequest(body)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if envelope.CorrelationID != "report-1" {
+		t.Fatalf("got correlation ID %q, want the request ID", envelope.CorrelationID)
+	}
+}
+
+func TestDecodeReportRequestUpcastsV1(t *testing.T) {
+	body := []byte(`{"id":"report-1","tenant_id":"merchant-1","report_type":"sales","parameters":{"format":"PDF"},"created_at":"2024-01-01T12:00:00Z"}`)
+
+	envelope, request, err := DecodeReportRequest(body)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if envelope.SchemaVersion != CurrentSchemaVersion || envelope.MessageType != models.MessageTypeReportRequest {
+		t.Fatalf("got version %d of %q, want %d of %q", envelope.SchemaVersion, envelope.MessageType, CurrentSchemaVersion, models.MessageTypeReportRequest)
+	}
+	if envelope.MessageID != "report-1" || envelope.CorrelationID != "report-1" {
+		t.Fatalf("got message ID %q and correlation ID %q, want the request ID", envelope.MessageID, envelope.CorrelationID)
+	}
+	if want := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC); !envelope.Timestamp.Equal(want) {
+		t.Fatalf("got timestamp %s, want the request's creation %s", envelope.Timestamp, want)
+	}
+	if request.ID != "report-1" || request.TenantID != "merchant-1" || request.ReportType != "sales" || request.Parameters["format"] != "PDF" {
+		t.Fatalf("got %+v", *request)
+	}
+}
+
+func TestDecodeReportRequestUpcastsV1WithoutCreation(t *testing.T) {
+	before := time.Now().UTC()
+	envelope, _, err := DecodeReportRequest([]byte(`{"id":"report-1","report_type":"sales"}`))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if envelope.Timestamp.Before(before) {
+		t.Fatalf("got timestamp %s, want the time of decoding", envelope.Timestamp)
+	}
+}
+
+func TestDecodeReportRequestRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error
+	}{
+		{"newer version", `{"schema_version":3,"message_type":"report.request","payload":{}}`, ErrUnsupportedVersion},
+		{"version 0", `{"schema_version":0}`, ErrInvalidMessage},
+		{"negative version", `{"schema_version":-1}`, ErrInvalidMessage},
+		{"not JSON", `not json`, ErrInvalidMessage},
+		{"v1 without id", `{"report_type":"sales"}`, ErrInvalidMessage},
+		{"v2 without payload", `{"schema_version":2,"message_type":"report.request","message_id":"m","correlation_id":"c","timestamp":"2024-01-01T12:00:00Z"}`, ErrInvalidMessage},
+		{"v2 of another type", `{"schema_version":2,"message_type":"report.result","message_id":"m","correlation_id":"c","timestamp":"2024-01-01T12:00:00Z","payload":{"id":"report-1","report_type":"sales"}}`, ErrInvalidMessage},
+		{"v2 payload without report type", `{"schema_version":2,"message_type":"report.request","message_id":"m","correlation_id":"c","timestamp":"2024-01-01T12:00:00Z","payload":{"id":"report-1"}}`, ErrInvalidMessage},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := DecodeReportRequest([]byte(test.body))
+			if !errors.Is(err, test.want) {
+				t.Fatalf("got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// UnknownType labels messages whose report type could not be parsed
+const UnknownType = "unknown"
+
+var (
+	// Published counts report requests confirmed by the broker
+	Published = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "report_published_total",
+		Help: "Report requests published and confirmed by RabbitMQ.",
+	}, []string{"report_type"})
+	// Consumed counts deliveries received from the report queues
+	Consumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "report_consumed_total",
+		Help: "Report request deliveries received from RabbitMQ.",
+	}, []string{"report_type"})
+	// Acked counts acknowledged deliveries
+	Acked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "report_acked_total",
+		Help: "Report request deliveries acknowledged.",
+	}, []string{"report_type"})
+	// Nacked counts negatively acknowledged deliveries, requeued or not
+	Nacked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "report_nacked_total",
+		Help: "Report request deliveries negatively acknowledged, requeued or not.",
+	}, []string{"report_type"})
+	// Retried counts redeliveries, of requeued deliveries or of those of a lost consumer
+	Retried = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "report_retried_total",
+		Help: "Report request deliveries received again after an earlier attempt.",
+	}, []string{"report_type"})
+	// DeadLettered counts deliveries rejected without requeue, the queues dead-letter them
+	DeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "report_dead_lettered_total",
+		Help: "Report request deliveries rejected without requeue and dead-lettered.",
+	}, []string{"report_type"})
+
+	// QueueWait observes the time from a request's creation to the start of its processing
+	QueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "report_queue_wait_seconds",
+		Help:    "Time from the creation of a report request to the start of its processing.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 15), // 100ms to about 27m
+	}, []string{"report_type"})
+	// GenerationDuration observes how long report generation takes
+	GenerationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "report_generation_duration_seconds",
+		Help:    "Time spent generating a report.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 12), // 50ms to about 100s
+	}, []string{"report_type", "outcome"})
+
+	// RedisErrors counts failed Redis commands
+	RedisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redis_errors_total",
+		Help: "Redis commands that failed.",
+	}, []string{"command"})
+	// RabbitMQErrors counts failed RabbitMQ operations
+	RabbitMQErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_errors_total",
+		Help: "RabbitMQ operations that failed.",
+	}, []string{"operation"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveWorkerPool exposes the running workers and in-flight deliveries of a report type's pool
+func ObserveWorkerPool(reportType string, workers func() int, inFlight func() int) {
+	labels := prometheus.Labels{"report_type": reportType}
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "report_workers_active",
+		Help:        "Workers running in the pool of a report type.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(workers()) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "report_deliveries_in_flight",
+		Help:        "Deliveries of a report type received and not acknowledged yet.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(inFlight()) })
+}
+
+// RedisHook counts failed Redis commands in RedisErrors
+// Missing keys, aborted transactions, cancelled contexts and scripts not cached yet are expected
+// and not counted; go-redis retries a NOSCRIPT EVALSHA with EVAL, which is counted if it fails
+type RedisHook struct{}
+
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	countRedisError(cmd)
+	return nil
+}
+
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		countRedisError(cmd)
+	}
+	return nil
+}
+
+func countRedisError(cmd redis.Cmder) {
+	err := cmd.Err()
+	if err == nil || err == redis.Nil || err == redis.TxFailedErr || errors.Is(err, context.Canceled) {
+		return
+	}
+	if strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		return
+	}
+	RedisErrors.WithLabelValues(cmd.Name()).Inc()
+}
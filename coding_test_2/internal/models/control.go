@@ -0,0 +1,15 @@
+package models
+
+// ControlAction is an instruction sent to the consumers over the control channel
+type ControlAction string
+
+const (
+	ControlCancel ControlAction = "cancel" // Abort processing of the report
+)
+
+// ControlMessage is published on the Redis control channel to reach every consumer
+type ControlMessage struct {
+	Action    ControlAction `json:"action"`
+	TenantID  string        `json:"tenant_id"`
+	RequestID string        `json:"request_id"`
+}
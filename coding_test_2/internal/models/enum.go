@@ -8,4 +8,16 @@ const (
 	StatusInProgress ReportStatus = "IN_PROGRESS"
 	StatusCompleted  ReportStatus = "COMPLETED"
 	StatusFailed     ReportStatus = "FAILED"
+	StatusRetrying   ReportStatus = "RETRYING"
+	StatusCancelled  ReportStatus = "CANCELLED"
+)
+
+// ReportFormat represents the output format of a generated report
+type ReportFormat string
+
+const (
+	FormatCSV  ReportFormat = "CSV"
+	FormatJSON ReportFormat = "JSON"
+	FormatXLSX ReportFormat = "XLSX"
+	FormatPDF  ReportFormat = "PDF"
 )
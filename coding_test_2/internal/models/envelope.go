@@ -0,0 +1,20 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MessageTypeReportRequest is the message type of envelopes carrying a ReportRequest
+const MessageTypeReportRequest = "report.request"
+
+// Envelope wraps every message published to RabbitMQ
+// SchemaVersion covers the envelope and its payload, older versions are upcast on consumption
+type Envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	MessageType   string          `json:"message_type"`
+	MessageID     string          `json:"message_id"`     // Unique per message, shared by its redeliveries
+	CorrelationID string          `json:"correlation_id"` // Ties the message to what caused it, e.g. an API call or a schedule
+	Timestamp     time.Time       `json:"timestamp"`
+	Payload       json.RawMessage `json:"payload"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// HealthStatus is the outcome of a health check
+type HealthStatus string
+
+const (
+	HealthOK   HealthStatus = "ok"
+	HealthFail HealthStatus = "fail"
+)
+
+// HealthCheckResult is the outcome of a single component check
+type HealthCheckResult struct {
+	Status HealthStatus `json:"status"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// HealthReport is returned by the health endpoints, it fails if any of its checks fails
+type HealthReport struct {
+	Status HealthStatus                 `json:"status"`
+	Phase  string                       `json:"phase"`
+	Checks map[string]HealthCheckResult `json:"checks"`
+}
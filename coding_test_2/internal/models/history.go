@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// StatusTransition records a single status change of a report
+type StatusTransition struct {
+	RequestID string       `json:"request_id"`
+	From      ReportStatus `json:"from,omitempty"` // Empty for the first transition
+	To        ReportStatus `json:"to"`
+	At        time.Time    `json:"at"`
+	Worker    string       `json:"worker,omitempty"` // Who made the change, e.g. "host-42/sales/worker-3"
+	Attempt   int          `json:"attempt"`          // Number of times processing was started so far
+	Error     string       `json:"error,omitempty"`
+}
+
+// ReportHistory is the full status history of a report
+type ReportHistory struct {
+	RequestID    string                   `json:"request_id"`
+	Transitions  []StatusTransition       `json:"transitions"`
+	TimeInStatus map[ReportStatus]float64 `json:"time_in_status_seconds"` // Time spent in each status
+}
+
+// NewReportHistory summarizes transitions, given in order, up to now
+// The current status accumulates time until now unless it is final
+func NewReportHistory(requestID string, transitions []StatusTransition, now time.Time) *ReportHistory {
+	history := &ReportHistory{
+		RequestID:    requestID,
+		Transitions:  transitions,
+		TimeInStatus: make(map[ReportStatus]float64),
+	}
+
+	for i, t := range transitions {
+		end := now
+		if i+1 < len(transitions) {
+			end = transitions[i+1].At
+		} else if t.To.IsFinal() {
+			break
+		}
+		history.TimeInStatus[t.To] += end.Sub(t.At).Seconds()
+	}
+	return history
+}
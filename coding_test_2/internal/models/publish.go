@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// PublishOutcome is the outbox relay's latest verdict on publishing a report request
+type PublishOutcome string
+
+const (
+	PublishConfirmed    PublishOutcome = "confirmed"     // Routed to a queue and persisted by the broker
+	PublishNacked       PublishOutcome = "nacked"        // Rejected by the broker, relayed again
+	PublishReturned     PublishOutcome = "returned"      // Unroutable, no queue is bound for the routing key, relayed again
+	PublishFailed       PublishOutcome = "failed"        // Not published or outcome unknown, relayed again
+	PublishDeadLettered PublishOutcome = "dead_lettered" // Given up after the outbox's max deliveries
+)
+
+// PublishRecord is the latest relay outcome of a report request
+type PublishRecord struct {
+	RequestID string         `json:"request_id"`
+	Outcome   PublishOutcome `json:"outcome"`
+	Error     string         `json:"error,omitempty"`
+	At        time.Time      `json:"at"`
+}
+
+// PublishSummary reports the broker's latest verdict for each submitted report request
+type PublishSummary struct {
+	Confirmed    []string `json:"confirmed"`     // Accepted and routed to a queue
+	Nacked       []string `json:"nacked"`        // Rejected by the broker
+	Returned     []string `json:"returned"`      // Unroutable, no queue received them
+	Failed       []string `json:"failed"`        // Not published or outcome unknown
+	DeadLettered []string `json:"dead_lettered"` // Never confirmed, the relay gave up on them
+	Pending      []string `json:"pending"`       // Not relayed yet
+}
+
+// Settled reports whether the relay is done with every request, confirmed or dead-lettered
+func (s *PublishSummary) Settled() bool {
+	return len(s.Nacked)+len(s.Returned)+len(s.Failed)+len(s.Pending) == 0
+}
@@ -1,20 +1,62 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // ReportRequest represents a request to generate a report
 type ReportRequest struct {
 	ID         string            `json:"id"`
-	ReportType string            `json:"report_type"` // e.g., "sales", "inventory"
+	TenantID   string            `json:"tenant_id,omitempty"` // Merchant the report belongs to, DefaultTenant if empty
+	ReportType string            `json:"report_type"`         // e.g., "sales", "inventory"
 	Parameters map[string]string `json:"parameters"`
 	CreatedAt  time.Time         `json:"created_at"`
+	Priority   int               `json:"priority,omitempty"` // 1 (lowest) to the configured maximum, 0 uses the type's default
+
+	// Optional webhook notified once the report is COMPLETED or FAILED
+	CallbackURL    string `json:"callback_url,omitempty"`
+	CallbackSecret string `json:"callback_secret,omitempty"` // Used to sign the webhook payload
+}
+
+// DefaultTenant is the tenant of requests submitted without one
+const DefaultTenant = "default"
+
+// Tenant returns the tenant of the request
+func (r ReportRequest) Tenant() string {
+	if r.TenantID == "" {
+		return DefaultTenant
+	}
+	return r.TenantID
+}
+
+// Key identifies the request's report in Redis, see ReportKey
+func (r ReportRequest) Key() string {
+	return ReportKey(r.Tenant(), r.ID)
+}
+
+// ReportKey identifies a report across tenants, request IDs are only unique within a tenant
+// It suffixes the report's Redis keys and is the member of its lease
+func ReportKey(tenantID string, requestID string) string {
+	return tenantID + ":" + requestID
+}
+
+// ParseReportKey splits a key made by ReportKey, tenant IDs never contain a colon
+func ParseReportKey(key string) (tenantID string, requestID string, ok bool) {
+	return strings.Cut(key, ":")
 }
 
 // ReportResult represents the final result of a processed report
 type ReportResult struct {
-	RequestID   string       `json:"request_id"`
-	Status      ReportStatus `json:"status"`
-	GeneratedAt time.Time    `json:"generated_at"`
-	ReportData  string       `json:"report_data,omitempty"` // Example report data (could be complex struct)
-	Error       string       `json:"error,omitempty"`
+	RequestID   string            `json:"request_id"`
+	TenantID    string            `json:"tenant_id,omitempty"`
+	Status      ReportStatus      `json:"status"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Artifact    *ArtifactMetadata `json:"artifact,omitempty"` // Where the generated report is stored
+	Error       string            `json:"error,omitempty"`
+}
+
+// Key identifies the result's report in Redis, see ReportKey
+func (r ReportResult) Key() string {
+	return ReportKey(r.TenantID, r.RequestID)
 }
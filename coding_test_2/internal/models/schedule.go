@@ -0,0 +1,113 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// DateRange is a report period relative to the run time of a schedule
+type DateRange string
+
+const (
+	RangePreviousDay   DateRange = "previous_day"   // The day before the run
+	RangePreviousWeek  DateRange = "previous_week"  // Monday to Sunday of the week before the run
+	RangePreviousMonth DateRange = "previous_month" // The calendar month before the run
+	RangeMonthToDate   DateRange = "month_to_date"  // The first day of the run's month to the day before the run
+)
+
+// dateLayout is the layout of the start_date and end_date parameters
+const dateLayout = "2006-01-02"
+
+// Valid reports whether the range is one of the known ones
+func (r DateRange) Valid() bool {
+	switch r {
+	case RangePreviousDay, RangePreviousWeek, RangePreviousMonth, RangeMonthToDate:
+		return true
+	}
+	return false
+}
+
+// Resolve returns the first and last day of the range for a run at runAt, in runAt's location
+// On the first of a month, month_to_date covers the previous day like previous_day
+func (r DateRange) Resolve(runAt time.Time) (time.Time, time.Time, bool) {
+	today := time.Date(runAt.Year(), runAt.Month(), runAt.Day(), 0, 0, 0, 0, runAt.Location())
+	yesterday := today.AddDate(0, 0, -1)
+
+	switch r {
+	case RangePreviousDay:
+		return yesterday, yesterday, true
+	case RangePreviousWeek:
+		daysSinceMonday := (int(today.Weekday()) + 6) % 7
+		monday := today.AddDate(0, 0, -daysSinceMonday-7)
+		return monday, monday.AddDate(0, 0, 6), true
+	case RangePreviousMonth:
+		first := time.Date(today.Year(), today.Month()-1, 1, 0, 0, 0, 0, today.Location())
+		return first, first.AddDate(0, 1, -1), true
+	case RangeMonthToDate:
+		first := time.Date(yesterday.Year(), yesterday.Month(), 1, 0, 0, 0, 0, yesterday.Location())
+		return first, yesterday, true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// Schedule submits a report request whenever its cron expression is due
+type Schedule struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Cron is a standard 5 field expression or descriptor such as "0 2 1 * *" or "@daily",
+	// optionally prefixed with a time zone: "CRON_TZ=Europe/Berlin 0 2 1 * *"
+	Cron string `json:"cron"`
+
+	// Template of the submitted requests, each run gets its own request ID
+	TenantID       string            `json:"tenant_id,omitempty"`
+	ReportType     string            `json:"report_type"`
+	Parameters     map[string]string `json:"parameters"`
+	Range          DateRange         `json:"range,omitempty"` // Sets start_date and end_date of each run, e.g. previous_month
+	Priority       int               `json:"priority,omitempty"`
+	CallbackURL    string            `json:"callback_url,omitempty"`
+	CallbackSecret string            `json:"callback_secret,omitempty"`
+
+	CreatedAt     time.Time  `json:"created_at"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	LastRequestID string     `json:"last_request_id,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextRunAt     time.Time  `json:"next_run_at"`
+}
+
+// Request returns the report request of the run due at runAt
+// The ID is derived from the schedule and run time so a run is never submitted twice
+// A Range is resolved in the schedule's time zone into the start_date and end_date parameters
+func (s Schedule) Request(runAt time.Time) ReportRequest {
+	params := s.Parameters
+	if start, end, ok := s.Range.Resolve(runAt.In(s.Location())); ok {
+		params = make(map[string]string, len(s.Parameters)+2)
+		for key, value := range s.Parameters {
+			params[key] = value
+		}
+		params["start_date"] = start.Format(dateLayout)
+		params["end_date"] = end.Format(dateLayout)
+	}
+
+	return ReportRequest{
+		ID:             s.ID + "-" + runAt.UTC().Format("20060102T150405Z"),
+		TenantID:       s.TenantID,
+		ReportType:     s.ReportType,
+		Parameters:     params,
+		Priority:       s.Priority,
+		CallbackURL:    s.CallbackURL,
+		CallbackSecret: s.CallbackSecret,
+	}
+}
+
+// Location returns the time zone of the cron expression, UTC if it has none or an unknown one
+func (s Schedule) Location() *time.Location {
+	for _, prefix := range []string{"CRON_TZ=", "TZ="} {
+		if rest, ok := strings.CutPrefix(s.Cron, prefix); ok {
+			name, _, _ := strings.Cut(rest, " ")
+			if loc, err := time.LoadLocation(name); err == nil {
+				return loc
+			}
+		}
+	}
+	return time.UTC
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleRequestResolvesRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		cron      string
+		dateRange DateRange
+		runAt     time.Time
+		wantStart string
+		wantEnd   string
+	}{
+		{"previous month", "0 2 1 * *", RangePreviousMonth, time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC), "2024-02-01", "2024-02-29"},
+		{"previous month across years", "0 2 1 * *", RangePreviousMonth, time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC), "2023-12-01", "2023-12-31"},
+		{"previous day", "@daily", RangePreviousDay, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "2024-02-29", "2024-02-29"},
+		{"previous week from a Wednesday", "0 6 * * 3", RangePreviousWeek, time.Date(2024, 3, 6, 6, 0, 0, 0, time.UTC), "2024-02-26", "2024-03-03"},
+		{"previous week from a Sunday", "0 6 * * 0", RangePreviousWeek, time.Date(2024, 3, 10, 6, 0, 0, 0, time.UTC), "2024-02-26", "2024-03-03"},
+		{"month to date", "@daily", RangeMonthToDate, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), "2024-03-01", "2024-03-14"},
+		{"month to date on the first", "@daily", RangeMonthToDate, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "2024-02-01", "2024-02-29"},
+		// 1 March 00:30 in Jakarta is still 29 February in UTC
+		{"schedule time zone", "CRON_TZ=Asia/Jakarta 30 0 1 * *", RangePreviousMonth, time.Date(2024, 2, 29, 17, 30, 0, 0, time.UTC), "2024-02-01", "2024-02-29"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule := Schedule{
+				ID:         "monthly-sales",
+				Cron:       test.cron,
+				ReportType: "sales",
+				Parameters: map[string]string{"format": "CSV"},
+				Range:      test.dateRange,
+			}
+
+			request := schedule.Request(test.runAt)
+			if request.Parameters["start_date"] != test.wantStart || request.Parameters["end_date"] != test.wantEnd {
+				t.Fatalf("got %s to %s, want %s to %s",
+					request.Parameters["start_date"], request.Parameters["end_date"], test.wantStart, test.wantEnd)
+			}
+			if request.Parameters["format"] != "CSV" {
+				t.Fatalf("got parameters %v, want the template's format kept", request.Parameters)
+			}
+			if len(schedule.Parameters) != 1 {
+				t.Fatalf("got template parameters %v, want them unchanged", schedule.Parameters)
+			}
+		})
+	}
+}
+
+func TestScheduleRequestWithoutRange(t *testing.T) {
+	schedule := Schedule{
+		ID:         "fixed",
+		Cron:       "@daily",
+		Parameters: map[string]string{"start_date": "2024-01-01", "end_date": "2024-01-31"},
+	}
+
+	request := schedule.Request(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	if request.ID != "fixed-20240301T000000Z" {
+		t.Fatalf("got ID %s", request.ID)
+	}
+	if request.Parameters["start_date"] != "2024-01-01" || request.Parameters["end_date"] != "2024-01-31" {
+		t.Fatalf("got parameters %v, want the fixed ones", request.Parameters)
+	}
+}
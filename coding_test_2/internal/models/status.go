@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransition is wrapped by every TransitionError
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// transitions lists the statuses each status may move to
+// The empty status is a report without any status yet
+var transitions = map[ReportStatus][]ReportStatus{
+	"":               {StatusPending},
+	StatusPending:    {StatusInProgress, StatusFailed, StatusCancelled},
+	StatusInProgress: {StatusInProgress, StatusCompleted, StatusFailed, StatusRetrying, StatusCancelled}, // IN_PROGRESS again when restarted after a lost worker
+	StatusRetrying:   {StatusInProgress, StatusFailed, StatusCancelled},
+}
+
+// CanTransition reports whether a report may move from one status to another
+// COMPLETED, FAILED and CANCELLED are final
+func CanTransition(from ReportStatus, to ReportStatus) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal reports whether no transition leaves the status
+func (s ReportStatus) IsFinal() bool {
+	return s != "" && len(transitions[s]) == 0
+}
+
+// TransitionError is returned when a status update would break the state machine
+type TransitionError struct {
+	RequestID string
+	From      ReportStatus
+	To        ReportStatus
+}
+
+func (e *TransitionError) Error() string {
+	from := e.From
+	if from == "" {
+		from = "none"
+	}
+	return fmt.Sprintf("%s: %s: %s -> %s", ErrInvalidTransition, e.RequestID, from, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
@@ -0,0 +1,11 @@
+package models
+
+// SubmitSummary reports the outcome of each report request handed to the outbox
+// Broker confirmations are handled later by the outbox relay, Publish reports them
+type SubmitSummary struct {
+	Submitted []string `json:"submitted"` // Recorded as PENDING, published by the relay
+	Existing  []string `json:"existing"`  // Skipped, a report with the same ID exists already
+	Failed    []string `json:"failed"`    // Not recorded
+
+	Publish *PublishSummary `json:"publish,omitempty"` // Relay outcomes of the submitted requests
+}
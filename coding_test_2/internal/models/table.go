@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// ReportTable is the format-independent content produced by a report generator
+type ReportTable struct {
+	Title       string     `json:"title"`
+	Columns     []string   `json:"columns"`
+	Rows        [][]string `json:"rows"`
+	GeneratedAt time.Time  `json:"generated_at"`
+}
+
+// ReportArtifact is a report rendered in its requested output format
+type ReportArtifact struct {
+	Format      ReportFormat
+	ContentType string
+	Data        []byte
+}
+
+// ArtifactMetadata describes a stored report artifact, the content itself lives in a ReportStore
+type ArtifactMetadata struct {
+	Store       string       `json:"store"`    // Backend holding the artifact, e.g. "filesystem" or "s3"
+	Key         string       `json:"key"`      // Object key within the store
+	Location    string       `json:"location"` // Backend-specific URI, e.g. "s3://bucket/key"
+	Format      ReportFormat `json:"format"`
+	ContentType string       `json:"content_type"`
+	Size        int64        `json:"size"`
+	Checksum    string       `json:"checksum"` // Hex encoded SHA-256 of the content
+}
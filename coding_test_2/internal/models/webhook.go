@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// WebhookDelivery records a single attempt to deliver a report result to its callback URL
+type WebhookDelivery struct {
+	RequestID   string    `json:"request_id"`
+	URL         string    `json:"url"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Success     bool      `json:"success"`
+	Error       string    `json:"error,omitempty"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
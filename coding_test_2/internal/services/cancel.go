@@ -0,0 +1,117 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	// ErrReportCancelled is the cause of a task context aborted by a cancellation
+	ErrReportCancelled = errors.New("report cancelled")
+	// ErrShuttingDown is the cause of a task context aborted because the drain period ran out
+	ErrShuttingDown = errors.New("interrupted by shutdown")
+	// ErrClaimLost is the cause of a task context aborted because its worker lost the claim
+	ErrClaimLost = errors.New("claim lost")
+)
+
+// runningTask is a task tracked while a worker runs it
+type runningTask struct {
+	cancel  context.CancelCauseFunc
+	started time.Time
+}
+
+// trackTask registers the cancel function of the running task of a report, by its report key
+// The returned function unregisters it once the task is over
+func (s *ConsumerService) trackTask(report string, cancel context.CancelCauseFunc) func() {
+	s.tasksMu.Lock()
+	s.tasks[report] = runningTask{cancel: cancel, started: time.Now()}
+	s.tasksMu.Unlock()
+
+	return func() {
+		s.tasksMu.Lock()
+		delete(s.tasks, report)
+		s.tasksMu.Unlock()
+	}
+}
+
+// cancelTask aborts the running task of a report, if this consumer runs it
+func (s *ConsumerService) cancelTask(report string) bool {
+	s.tasksMu.Lock()
+	defer s.tasksMu.Unlock()
+
+	task, running := s.tasks[report]
+	if running {
+		task.cancel(ErrReportCancelled)
+	}
+	return running
+}
+
+// AbortTasks aborts every running task with the given cause and returns how many there were
+func (s *ConsumerService) AbortTasks(cause error) int {
+	s.tasksMu.Lock()
+	defer s.tasksMu.Unlock()
+
+	for _, task := range s.tasks {
+		task.cancel(cause)
+	}
+	return len(s.tasks)
+}
+
+// LongestTask returns for how long the oldest running task has been running, 0 if none is
+func (s *ConsumerService) LongestTask() time.Duration {
+	s.tasksMu.Lock()
+	defer s.tasksMu.Unlock()
+
+	var longest time.Duration
+	for _, task := range s.tasks {
+		if age := time.Since(task.started); age > longest {
+			longest = age
+		}
+	}
+	return longest
+}
+
+// WatchControl applies control messages published on CHANNEL_REPORT_CONTROL until ctx is cancelled
+// Every consumer receives them, the one running the report aborts its task
+func (s *ConsumerService) WatchControl(ctx context.Context) error {
+	pubsub := s.rdb.Subscribe(ctx, config.CHANNEL_REPORT_CONTROL)
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", config.CHANNEL_REPORT_CONTROL, err)
+	}
+
+	log.Println("[Control] Watching for control messages")
+	msgs := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-msgs:
+			if !ok {
+				return fmt.Errorf("subscription to %s closed", config.CHANNEL_REPORT_CONTROL)
+			}
+
+			var control models.ControlMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &control); err != nil {
+				log.Printf("[Control] Failed to parse control message: %v", err)
+				continue
+			}
+
+			switch control.Action {
+			case models.ControlCancel:
+				if s.cancelTask(models.ReportKey(control.TenantID, control.RequestID)) {
+					log.Printf("[Control] Aborted running task of %s", control.RequestID)
+				}
+			default:
+				log.Printf("[Control] Ignoring unknown action %q for %s", control.Action, control.RequestID)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// claimPollInterval is how often a worker retries a claim held by another worker
+const claimPollInterval = 1 * time.Second
+
+// claimOutcome is the result of trying to claim a report for processing
+type claimOutcome int
+
+const (
+	// claimAcquired means the caller owns the report until the lease expires or it is released
+	claimAcquired claimOutcome = iota
+	// claimCompleted means the report was already COMPLETED and must not be generated again
+	claimCompleted
+	// claimHeld means another worker currently owns the report
+	claimHeld
+)
+
+// claimScript atomically checks the report status and takes the claim with a lease
+// The lease expiry is indexed in KEY_LEASES for the reaper, the report key (see models.ReportKey) is its member
+// KEYS[1] status key, KEYS[2] claim key, KEYS[3] leases set, ARGV[1] owner, ARGV[2] lease in ms,
+// ARGV[3] completed status, ARGV[4] report key, ARGV[5] lease expiry (unix ms)
+var claimScript = redis.NewScript(`
+local status = redis.call('GET', KEYS[1])
+if status then
+	local ok, result = pcall(cjson.decode, status)
+	if ok and result.status == ARGV[3] then
+		return {'completed', status}
+	end
+end
+if redis.call('SET', KEYS[2], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	redis.call('ZADD', KEYS[3], ARGV[5], ARGV[4])
+	return {'acquired', ''}
+end
+return {'held', redis.call('GET', KEYS[2]) or ''}
+`)
+
+// releaseScript deletes a claim or lease only if it is still owned by the caller
+// KEYS[1] claim key, ARGV[1] owner
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// renewClaimScript extends a claim and its indexed lease if it is still owned by the caller
+// KEYS[1] claim key, KEYS[2] leases set, ARGV[1] owner, ARGV[2] lease in ms, ARGV[3] report key,
+// ARGV[4] lease expiry (unix ms)
+var renewClaimScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+redis.call('ZADD', KEYS[2], ARGV[4], ARGV[3])
+return 1
+`)
+
+// releaseClaimScript deletes a claim and its indexed lease if it is still owned by the caller
+// KEYS[1] claim key, KEYS[2] leases set, ARGV[1] owner, ARGV[2] report key
+var releaseClaimScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[2])
+return redis.call('DEL', KEYS[1])
+`)
+
+// claimReport tries once to claim a report for owner
+// For claimCompleted the stored result is returned so the duplicate can be acknowledged
+func (s *ConsumerService) claimReport(ctx context.Context, tenantID string, requestID string, owner string) (claimOutcome, *models.ReportResult, error) {
+	lease := s.cfg.Consumer.ClaimLease
+	report := models.ReportKey(tenantID, requestID)
+	keys := []string{config.KEY_PREFIX_REPORT_STATUS + report, config.KEY_PREFIX_REPORT_CLAIM + report, config.KEY_LEASES}
+	reply, err := claimScript.Run(ctx, s.rdb, keys, owner, lease.Milliseconds(), string(models.StatusCompleted),
+		report, time.Now().Add(lease).UnixMilli()).Slice()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to claim %s: %w", requestID, err)
+	}
+
+	outcome, _ := reply[0].(string)
+	switch outcome {
+	case "acquired":
+		return claimAcquired, nil, nil
+	case "completed":
+		resultJson, _ := reply[1].(string)
+		var result models.ReportResult
+		if err := json.Unmarshal([]byte(resultJson), &result); err != nil {
+			return 0, nil, fmt.Errorf("failed to parse status for %s: %w", requestID, err)
+		}
+		return claimCompleted, &result, nil
+	default:
+		return claimHeld, nil, nil
+	}
+}
+
+// awaitClaim claims a report, waiting while another worker holds it
+// The wait ends when the holder releases the claim, its lease expires or the report is COMPLETED
+func (s *ConsumerService) awaitClaim(ctx context.Context, tenantID string, requestID string, owner string) (claimOutcome, *models.ReportResult, error) {
+	for {
+		outcome, result, err := s.claimReport(ctx, tenantID, requestID, owner)
+		if err != nil || outcome != claimHeld {
+			return outcome, result, err
+		}
+
+		select {
+		case <-time.After(claimPollInterval):
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		}
+	}
+}
+
+// renewClaim extends the lease of a claim taken by owner, it returns false if the claim was lost
+func (s *ConsumerService) renewClaim(ctx context.Context, tenantID string, requestID string, owner string) (bool, error) {
+	lease := s.cfg.Consumer.ClaimLease
+	report := models.ReportKey(tenantID, requestID)
+	keys := []string{config.KEY_PREFIX_REPORT_CLAIM + report, config.KEY_LEASES}
+	renewed, err := renewClaimScript.Run(ctx, s.rdb, keys, owner, lease.Milliseconds(), report, time.Now().Add(lease).UnixMilli()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to renew claim on %s: %w", requestID, err)
+	}
+	return renewed == 1, nil
+}
+
+// heartbeat renews the claim of owner every heartbeat interval until ctx is done
+// A worker that stops renewing it (e.g. its process died) lets the reaper recover the report
+// A lost claim aborts the task with ErrClaimLost, the report may be processed elsewhere already
+func (s *ConsumerService) heartbeat(ctx context.Context, tenantID string, requestID string, owner string, abort context.CancelCauseFunc) {
+	ticker := time.NewTicker(s.cfg.Recovery.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewed, err := s.renewClaim(ctx, tenantID, requestID, owner)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[Heartbeat] %v", err)
+			}
+			continue
+		}
+		if !renewed {
+			log.Printf("[Heartbeat] Lost the claim on %s, aborting its task as it may be retried elsewhere", requestID)
+			abort(ErrClaimLost)
+			return
+		}
+	}
+}
+
+// releaseClaim gives up a claim taken by owner, a claim taken over by someone else is left alone
+func (s *ConsumerService) releaseClaim(ctx context.Context, tenantID string, requestID string, owner string) error {
+	report := models.ReportKey(tenantID, requestID)
+	keys := []string{config.KEY_PREFIX_REPORT_CLAIM + report, config.KEY_LEASES}
+	err := releaseClaimScript.Run(ctx, s.rdb, keys, owner, report).Err()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to release claim on %s: %w", requestID, err)
+	}
+	return nil
+}
@@ -2,143 +2,411 @@ package services
 
 import (
 	"coding_test_2/internal/config"
+	"coding_test_2/internal/generators"
+	"coding_test_2/internal/metrics"
 	"coding_test_2/internal/models"
+	"coding_test_2/internal/storage"
+	"coding_test_2/internal/tracing"
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
-	"github.com/streadway/amqp"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ConsumerServiceInterface interface {
-	UpdateReportStatus(ctx context.Context, requestID string, status models.ReportStatus, reportData string, errMsg string) (*models.ReportResult, error)
-	ReportWorker(ctx context.Context, workerID int, msgs <-chan amqp.Delivery, results chan<- models.ReportResult)
-	ResultAckHandler(ctx context.Context, results <-chan models.ReportResult, deliveries map[string]amqp.Delivery)
-	SimulateReportGeneration(ctx context.Context, request models.ReportRequest) (string, error)
+	UpdateReportStatus(ctx context.Context, worker string, tenantID string, requestID string, status models.ReportStatus, artifact *models.ArtifactMetadata, errMsg string) (*models.ReportResult, error)
+	ReportWorker(ctx context.Context, reportType string, workerID int, stop <-chan struct{}, msgs <-chan Delivery, results chan<- models.ReportResult)
+	ResultAckHandler(ctx context.Context, results <-chan models.ReportResult, deliveries *DeliveryTracker)
+	GenerateReport(ctx context.Context, request models.ReportRequest) (*models.ReportArtifact, error)
+	StoreArtifact(ctx context.Context, request models.ReportRequest, artifact *models.ReportArtifact) (*models.ArtifactMetadata, error)
+	SetWorkerTimeout(timeout time.Duration)
+	WatchControl(ctx context.Context) error
+	AbortTasks(cause error) int
+	LongestTask() time.Duration
+	CountUnsupportedRequeue(ctx context.Context, messageKey string) (int64, error)
+	AcquireTenantSlot(ctx context.Context, tenantID string, requestID string) (bool, error)
+	ReleaseTenantSlot(ctx context.Context, tenantID string, requestID string) error
+	Instance() string
 }
 
+// Backoff of workers requeueing deliveries because Redis failed (claims, status updates),
+// doubled per consecutive failure
+// Waiting workers take no new deliveries, so consumption slows down while Redis is unavailable
+const (
+	requeueInitialBackoff = 500 * time.Millisecond
+	requeueMaxBackoff     = 30 * time.Second
+)
+
 type ConsumerService struct {
-	rdb *redis.Client
-	ch  *amqp.Channel
+	cfg        *config.Config
+	rdb        *redis.Client
+	webhook    WebhookServiceInterface
+	generators *generators.Registry
+	store      storage.ReportStore
+	instance   string // Name of this process in status histories
+
+	workerTimeout atomic.Int64 // Per-task timeout, updated at runtime by SetWorkerTimeout
+	redisFailures atomic.Int64 // Consecutive Redis failures of the workers, see backOff
+
+	tasksMu sync.Mutex
+	tasks   map[string]runningTask // Running tasks by report key, aborted on cancellation
 }
 
-func NewConsumerService(rdb *redis.Client, ch *amqp.Channel) ConsumerServiceInterface {
-	return &ConsumerService{
-		rdb: rdb,
-		ch:  ch,
+func NewConsumerService(cfg *config.Config, rdb *redis.Client, webhook WebhookServiceInterface, registry *generators.Registry, store storage.ReportStore) ConsumerServiceInterface {
+	s := &ConsumerService{
+		cfg:        cfg,
+		rdb:        rdb,
+		webhook:    webhook,
+		generators: registry,
+		store:      store,
+		instance:   instanceName(),
+		tasks:      make(map[string]runningTask),
 	}
+	s.SetWorkerTimeout(cfg.Consumer.WorkerTimeout)
+	return s
 }
 
-// UpdateReportStatus updates the status of a report in Redis
-func (s *ConsumerService) UpdateReportStatus(ctx context.Context, requestID string, status models.ReportStatus, reportData string, errMsg string) (*models.ReportResult, error) {
-	result := models.ReportResult{
-		RequestID:   requestID,
-		Status:      status,
-		GeneratedAt: time.Now().UTC(),
-		ReportData:  reportData,
-		Error:       errMsg,
-	}
+// Instance returns the name of this process, recorded in status histories
+func (s *ConsumerService) Instance() string {
+	return s.instance
+}
 
-	resultJson, err := json.Marshal(result)
-	if err != nil {
-		log.Printf("[Redis] Failed to marshal result for %s: %s", requestID, err)
-		return nil, err
-	}
+// SetWorkerTimeout changes the timeout applied to tasks started from now on
+func (s *ConsumerService) SetWorkerTimeout(timeout time.Duration) {
+	s.workerTimeout.Store(int64(timeout))
+}
 
-	key := config.KEY_PREFIX_REPORT_STATUS + requestID
-	err = s.rdb.Set(ctx, key, string(resultJson), 24*time.Hour).Err() // TTL: 24 hours
-	if err != nil {
-		log.Printf("[Redis] Failed to update status for %s: %s", requestID, status)
-		return nil, err
-	}
+// UpdateReportStatus updates the status of a report in Redis, see updateReportStatus
+func (s *ConsumerService) UpdateReportStatus(ctx context.Context, worker string, tenantID string, requestID string, status models.ReportStatus, artifact *models.ArtifactMetadata, errMsg string) (*models.ReportResult, error) {
+	return updateReportStatus(ctx, s.rdb, worker, tenantID, requestID, status, artifact, errMsg)
+}
 
-	if status == models.StatusCompleted || status == models.StatusFailed {
-		key := config.KEY_PREFIX_REPORT_DATA + requestID
-		err := s.rdb.Set(ctx, key, string(resultJson), 24*time.Hour).Err() // TTL: 24 hours
-		if err != nil {
-			log.Printf("[Redis] Failed to update report data for %s: %s", requestID, reportData)
-			return nil, err
-		}
+// CountUnsupportedRequeue counts a requeue of a message of a newer schema version and returns
+// how often it was requeued so far, by any instance
+// RabbitMQ does not count requeues of classic queues, the count is kept in Redis for a day
+func (s *ConsumerService) CountUnsupportedRequeue(ctx context.Context, messageKey string) (int64, error) {
+	key := config.KEY_PREFIX_UNSUPPORTED_REQUEUES + messageKey
+	var requeues *redis.IntCmd
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		requeues = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, 24*time.Hour) // TTL: 24 hours
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count requeues of message %s: %w", messageKey, err)
 	}
-
-	log.Printf("[Redis] Updated status for %s: %s", requestID, status)
-	return &result, nil
+	return requeues.Val(), nil
 }
 
 // reportWorker processes report requests from RabbitMQ
-// It updates status in Redis and simulates report generation
-func (s *ConsumerService) ReportWorker(ctx context.Context, workerID int, msgs <-chan amqp.Delivery, results chan<- models.ReportResult) {
-	log.Printf("[Worker %d] Started", workerID)
-	defer log.Printf("[Worker %d] Stopped", workerID)
+// It updates status in Redis and generates the report for the request's type
+// Closing stop retires the worker once its current task, if any, is finished
+func (s *ConsumerService) ReportWorker(ctx context.Context, reportType string, workerID int, stop <-chan struct{}, msgs <-chan Delivery, results chan<- models.ReportResult) {
+	// Pools of different report types number their workers from 1 each, the type tells them apart
+	name := fmt.Sprintf("%s/worker-%d", reportType, workerID)
+	worker := s.instance + "/" + name // Recorded in status histories
+	log.Printf("[Worker %s] Started", name)
+	defer log.Printf("[Worker %s] Stopped", name)
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("[Worker %d] Context cancelled", workerID)
+			log.Printf("[Worker %s] Context cancelled", name)
+			return
+		case <-stop:
+			log.Printf("[Worker %s] Retired", name)
 			return
 		case msg, ok := <-msgs:
 			if !ok {
-				log.Printf("[Worker %d] Message channel closed", workerID)
+				log.Printf("[Worker %s] Message channel closed", name)
 				return
 			}
 
-			// Parse the request
-			var request models.ReportRequest
-			if err := json.Unmarshal(msg.Body, &request); err != nil {
-				log.Printf("[Worker %d] Failed to unmarshal message: %v", workerID, err)
-				msg.Nack(false, false) // Don't requeue malformed messages
-				continue
+			if !s.processDelivery(ctx, name, worker, msg, results) {
+				return
 			}
+		}
+	}
+}
 
-			log.Printf("[Worker %d] Processing request: %s", workerID, request.ID)
+// processDelivery claims and processes a single report request and hands its result to the
+// ack handler, it returns false if ctx was cancelled
+func (s *ConsumerService) processDelivery(ctx context.Context, name string, worker string, msg Delivery, results chan<- models.ReportResult) bool {
+	// Continue the trace of the request's submission from the message headers
+	ctx, span := tracing.Start(tracing.ExtractAMQP(ctx, msg.Headers), "report.process", trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
 
-			// Update status to IN_PROGRESS
-			result, err := s.UpdateReportStatus(ctx, request.ID, models.StatusInProgress, "", "")
-			if err != nil {
-				log.Printf("[Worker %d] Failed to update status for request %s: %v", workerID, request.ID, err)
-				continue
-			}
+	// Validated and decoded by the distributor already
+	envelope, request := msg.Envelope, msg.Request
+	tenantID := request.Tenant()
 
-			// Create a timeout context for this specific task
-			taskCtx, cancel := context.WithTimeout(ctx, config.WORKER_TIMEOUT)
+	span.SetAttributes(tracing.ReportAttributes(request.ID, request.ReportType)...)
+	span.SetAttributes(attribute.Bool("messaging.rabbitmq.redelivered", msg.Redelivered))
+	span.SetAttributes(
+		attribute.String("messaging.message.id", envelope.MessageID),
+		attribute.String("messaging.message.conversation_id", envelope.CorrelationID),
+		attribute.Int("messaging.message.schema_version", envelope.SchemaVersion),
+	)
 
-			// Process the report
-			reportData, err := s.SimulateReportGeneration(taskCtx, request)
-			cancel() // Clean up the timeout context
-			if err != nil {
-				result.Status = models.StatusFailed
-				result.Error = err.Error()
-			} else {
-				result.Status = models.StatusCompleted
-			}
+	// A redelivered message may already have been processed before the previous consumer
+	// went away, the claim below tells whether the work has to be done again
+	if msg.Redelivered {
+		log.Printf("[Worker %s] Request %s was redelivered, checking earlier processing", name, request.ID)
+	}
 
-			// Create result based on processing outcome
-			result, err = s.UpdateReportStatus(ctx, result.RequestID, result.Status, reportData, result.Error)
-			if err != nil {
-				log.Printf("[Worker %d] Failed to update status for request %s: %v", workerID, request.ID, err)
-				continue
+	// Claim the request so duplicate deliveries are not processed concurrently or twice
+	owner := uuid.NewString()
+	claim, result, err := s.awaitClaim(ctx, tenantID, request.ID, owner)
+	if err != nil {
+		log.Printf("[Worker %s] Failed to claim request %s, requeueing it: %v", name, request.ID, err)
+		if !s.backOff(ctx) {
+			return false
+		}
+		return s.requeue(ctx, tenantID, request.ID, results)
+	}
+	s.redisFailures.Store(0)
+	if claim == claimCompleted {
+		// Already generated, acknowledge the duplicate without regenerating
+		log.Printf("[Worker %s] Request %s is already COMPLETED, skipping duplicate delivery", name, request.ID)
+		select {
+		case results <- *result:
+		case <-ctx.Done():
+			return false
+		}
+		return true
+	}
+
+	log.Printf("[Worker %s] Processing request: %s", name, request.ID)
+
+	// Update status to IN_PROGRESS
+	result, err = s.UpdateReportStatus(ctx, worker, tenantID, request.ID, models.StatusInProgress, nil, "")
+	if err != nil {
+		log.Printf("[Worker %s] Failed to update status for request %s: %v", name, request.ID, err)
+		s.releaseClaim(ctx, tenantID, request.ID, owner)
+		return s.settleRejected(ctx, tenantID, request.ID, err, results)
+	}
+
+	if !request.CreatedAt.IsZero() {
+		metrics.QueueWait.WithLabelValues(request.ReportType).Observe(time.Since(request.CreatedAt).Seconds())
+		_, wait := tracing.Start(ctx, "report.queue_wait", trace.WithTimestamp(request.CreatedAt))
+		wait.End()
+	}
+
+	// Create a timeout context for this specific task
+	// A cancellation received on the control channel aborts it as well
+	taskCtx, cancel := context.WithTimeout(ctx, time.Duration(s.workerTimeout.Load()))
+	taskCtx, abort := context.WithCancelCause(taskCtx)
+	untrack := s.trackTask(request.Key(), abort)
+
+	// Keep the claim alive while the task runs, it stops with the task context
+	go s.heartbeat(taskCtx, tenantID, request.ID, owner, abort)
+
+	// Process the report and upload the artifact to the report store
+	var metadata *models.ArtifactMetadata
+	artifact, err := s.GenerateReport(taskCtx, request)
+	if err == nil {
+		metadata, err = s.StoreArtifact(taskCtx, request, artifact)
+	}
+	cancelled := errors.Is(context.Cause(taskCtx), ErrReportCancelled)
+	interrupted := errors.Is(context.Cause(taskCtx), ErrShuttingDown)
+	claimLost := errors.Is(context.Cause(taskCtx), ErrClaimLost)
+	untrack()
+	abort(nil)
+	cancel() // Clean up the timeout context
+
+	if cancelled {
+		// The report is CANCELLED already, acknowledge the delivery without a result
+		log.Printf("[Worker %s] Request %s was cancelled, abandoning it", name, request.ID)
+		if err := s.releaseClaim(ctx, tenantID, request.ID, owner); err != nil {
+			log.Printf("[Worker %s] %v", name, err)
+		}
+		select {
+		case results <- models.ReportResult{RequestID: request.ID, TenantID: tenantID, Status: models.StatusCancelled}:
+		case <-ctx.Done():
+			return false
+		}
+		return true
+	}
+
+	if claimLost {
+		// The reaper recovered the report after the lease expired, leave its status alone and
+		// hand the delivery back so it is redelivered as the reaper expects
+		log.Printf("[Worker %s] Lost the claim on request %s, requeueing it", name, request.ID)
+		return s.requeue(ctx, tenantID, request.ID, results)
+	}
+
+	if interrupted {
+		// Hand the report back to the queue, another consumer retries it
+		log.Printf("[Worker %s] Request %s interrupted by shutdown, requeueing it", name, request.ID)
+		result, err = s.UpdateReportStatus(ctx, worker, tenantID, request.ID, models.StatusRetrying, nil, ErrShuttingDown.Error())
+		if err := s.releaseClaim(ctx, tenantID, request.ID, owner); err != nil {
+			log.Printf("[Worker %s] %v", name, err)
+		}
+		if err == nil {
+			if err := awaitRedelivery(ctx, s.rdb, tenantID, request.ID, s.cfg.Recovery.RedeliveryTimeout); err != nil {
+				log.Printf("[Worker %s] %v", name, err)
 			}
+		}
+		if err != nil {
+			log.Printf("[Worker %s] Failed to update status for request %s: %v", name, request.ID, err)
+			return s.settleRejected(ctx, tenantID, request.ID, err, results)
+		}
+		select {
+		case results <- *result:
+		case <-ctx.Done():
+			return false
+		}
+		return true
+	}
 
-			// Send result for acknowledgment handling
-			select {
-			case results <- *result:
-			case <-ctx.Done():
-				log.Printf("[Worker %d] Context cancelled while sending result", workerID)
-				return
+	if err != nil && s.retryable(ctx, tenantID, request.ID, err) {
+		// Transient failure with attempts left, hand the report back to the queue
+		log.Printf("[Worker %s] Request %s failed, requeueing it for another attempt: %v", name, request.ID, err)
+		result, err = s.UpdateReportStatus(ctx, worker, tenantID, request.ID, models.StatusRetrying, nil, err.Error())
+		if err := s.releaseClaim(ctx, tenantID, request.ID, owner); err != nil {
+			log.Printf("[Worker %s] %v", name, err)
+		}
+		if err == nil {
+			if err := awaitRedelivery(ctx, s.rdb, tenantID, request.ID, s.cfg.Recovery.RedeliveryTimeout); err != nil {
+				log.Printf("[Worker %s] %v", name, err)
 			}
+		}
+		if err != nil {
+			log.Printf("[Worker %s] Failed to update status for request %s: %v", name, request.ID, err)
+			return s.settleRejected(ctx, tenantID, request.ID, err, results)
+		}
+		select {
+		case results <- *result:
+		case <-ctx.Done():
+			return false
+		}
+		return true
+	}
+
+	if err != nil {
+		result.Status = models.StatusFailed
+		result.Error = err.Error()
+	} else {
+		result.Status = models.StatusCompleted
+	}
 
-			log.Printf("[Worker %d] Finished processing request: %s (Status: %s)",
-				workerID, request.ID, result.Status)
+	// Create result based on processing outcome
+	// The claim is released afterwards, a COMPLETED status keeps later duplicates out
+	result, err = s.UpdateReportStatus(ctx, worker, tenantID, request.ID, result.Status, metadata, result.Error)
+	if err := s.releaseClaim(ctx, tenantID, request.ID, owner); err != nil {
+		log.Printf("[Worker %s] %v", name, err)
+	}
+	if err != nil {
+		log.Printf("[Worker %s] Failed to update status for request %s: %v", name, request.ID, err)
+		return s.settleRejected(ctx, tenantID, request.ID, err, results)
+	}
+
+	// Notify the requester's callback URL, if any
+	s.webhook.Dispatch(ctx, request, *result)
+
+	// Send result for acknowledgment handling
+	select {
+	case results <- *result:
+	case <-ctx.Done():
+		log.Printf("[Worker %s] Context cancelled while sending result", name)
+		return false
+	}
+
+	span.SetAttributes(attribute.String("report.status", string(result.Status)))
+	if result.Status == models.StatusFailed {
+		span.SetStatus(codes.Error, result.Error)
+	}
+	log.Printf("[Worker %s] Finished processing request: %s (Status: %s)",
+		name, request.ID, result.Status)
+	return true
+}
+
+// retryable reports whether a failed report is retried rather than FAILED: permanent errors
+// (e.g. invalid parameters) never are, transient ones until the report used up its attempts
+func (s *ConsumerService) retryable(ctx context.Context, tenantID string, requestID string, err error) bool {
+	if generators.IsPermanent(err) {
+		return false
+	}
+	attempt, err := lastAttempt(ctx, s.rdb, tenantID, requestID)
+	if err != nil {
+		log.Printf("[Worker] Failed to get attempts of %s, failing it: %v", requestID, err)
+		return false
+	}
+	return attempt < s.cfg.Recovery.MaxAttempts
+}
+
+// settleRejected hands a request whose status update failed to the ack handler
+// If the state machine rejected it because the report already reached a final status, or the
+// reaper marked it RETRYING after this worker's lease expired, the delivery is settled after
+// that status; other errors (e.g. Redis unavailable) requeue it after backing off, see backOff
+// It returns false if ctx was cancelled
+func (s *ConsumerService) settleRejected(ctx context.Context, tenantID string, requestID string, err error, results chan<- models.ReportResult) bool {
+	var transitionErr *models.TransitionError
+	if !errors.As(err, &transitionErr) || !(transitionErr.From.IsFinal() || transitionErr.From == models.StatusRetrying) {
+		if !s.backOff(ctx) {
+			return false
 		}
+		return s.requeue(ctx, tenantID, requestID, results)
+	}
+
+	select {
+	case results <- models.ReportResult{RequestID: requestID, TenantID: tenantID, Status: transitionErr.From}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// requeue hands a request back to the ack handler to requeue its delivery, so it is neither
+// left unacknowledged nor tracked as in progress; callers back off first, see backOff
+// It returns false if ctx was cancelled
+func (s *ConsumerService) requeue(ctx context.Context, tenantID string, requestID string, results chan<- models.ReportResult) bool {
+	select {
+	case results <- models.ReportResult{RequestID: requestID, TenantID: tenantID, Status: models.StatusRetrying}:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
+// backOff waits before a delivery is requeued after a Redis failure, longer with each
+// consecutive failure up to requeueMaxBackoff, so deliveries do not loop between the queue
+// and the workers while Redis is unavailable; it returns false if ctx was cancelled
+func (s *ConsumerService) backOff(ctx context.Context) bool {
+	select {
+	case <-time.After(requeueBackoff(s.redisFailures.Add(1))):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// requeueBackoff returns how long to wait after the given number of consecutive failures
+func requeueBackoff(failures int64) time.Duration {
+	backoff := requeueInitialBackoff
+	for i := int64(1); i < failures && backoff < requeueMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, requeueMaxBackoff)
+}
+
 // resultAckHandler handles RabbitMQ message acknowledgments based on processing results
-func (s *ConsumerService) ResultAckHandler(ctx context.Context, results <-chan models.ReportResult, deliveries map[string]amqp.Delivery) {
+// RETRYING results are requeued, they come from tasks interrupted by a shutdown, transient
+// failures with attempts left and requests that could not be claimed or updated, see requeue
+// FAILED results are final (permanent errors or no attempts left) and are dead-lettered
+func (s *ConsumerService) ResultAckHandler(ctx context.Context, results <-chan models.ReportResult, deliveries *DeliveryTracker) {
 	log.Println("[AckHandler] Started")
 	defer log.Println("[AckHandler] Stopped")
 
@@ -153,28 +421,52 @@ func (s *ConsumerService) ResultAckHandler(ctx context.Context, results <-chan m
 				return
 			}
 
-			delivery, exists := deliveries[result.RequestID]
-			if exists {
-				delete(deliveries, result.RequestID)
-			}
-
+			delivery, exists := deliveries.Take(result.Key())
 			if !exists {
 				log.Printf("[AckHandler] No delivery found for request: %s", result.RequestID)
 				continue
 			}
 
+			// Free the tenant's concurrency slot taken when the delivery was dispatched
+			reportType := delivery.Request.ReportType
+			if err := s.ReleaseTenantSlot(ctx, delivery.Request.Tenant(), result.RequestID); err != nil {
+				log.Printf("[AckHandler] %v", err)
+			}
+
 			if result.Status == models.StatusCompleted {
 				if err := delivery.Ack(false); err != nil {
 					log.Printf("[AckHandler] Failed to ack message for %s: %v", result.RequestID, err)
+					metrics.RabbitMQErrors.WithLabelValues("ack").Inc()
 				} else {
 					log.Printf("[AckHandler] Acknowledged successful processing of %s", result.RequestID)
+					metrics.Acked.WithLabelValues(reportType).Inc()
+				}
+			} else if result.Status == models.StatusCancelled {
+				// Nothing went wrong, the report is no longer wanted
+				if err := delivery.Ack(false); err != nil {
+					log.Printf("[AckHandler] Failed to ack message for %s: %v", result.RequestID, err)
+					metrics.RabbitMQErrors.WithLabelValues("ack").Inc()
+				} else {
+					log.Printf("[AckHandler] Acknowledged cancelled request %s", result.RequestID)
+					metrics.Acked.WithLabelValues(reportType).Inc()
+				}
+			} else if result.Status == models.StatusRetrying {
+				if err := delivery.Nack(false, true); err != nil {
+					log.Printf("[AckHandler] Failed to requeue message for %s: %v", result.RequestID, err)
+					metrics.RabbitMQErrors.WithLabelValues("nack").Inc()
+				} else {
+					log.Printf("[AckHandler] Requeued %s", result.RequestID)
+					metrics.Nacked.WithLabelValues(reportType).Inc()
 				}
 			} else {
-				// For failed processing, we nack without requeue
+				// Failed for good, nack without requeue so it is dead-lettered
 				if err := delivery.Nack(false, false); err != nil {
 					log.Printf("[AckHandler] Failed to nack message for %s: %v", result.RequestID, err)
+					metrics.RabbitMQErrors.WithLabelValues("nack").Inc()
 				} else {
 					log.Printf("[AckHandler] Nacked failed processing of %s", result.RequestID)
+					metrics.Nacked.WithLabelValues(reportType).Inc()
+					metrics.DeadLettered.WithLabelValues(reportType).Inc()
 				}
 			}
 		}
@@ -184,33 +476,57 @@ func (s *ConsumerService) ResultAckHandler(ctx context.Context, results <-chan m
 // StartReportProcessor orchestrates the consumer side
 // It connects to RabbitMQ, starts workers, and handles message delivery
 
-// SimulateReportGeneration simulates the actual report generation process
-// It includes random delays and a chance of failure
+// GenerateReport generates the report using the generator registered for its ReportType
+// and renders it in the format requested by the "format" parameter
+// Unknown report types, formats and invalid parameters fail with a permanent error
 // It also respects its own context for timeout/cancellation
-func (s *ConsumerService) SimulateReportGeneration(ctx context.Context, request models.ReportRequest) (string, error) {
+func (s *ConsumerService) GenerateReport(ctx context.Context, request models.ReportRequest) (*models.ReportArtifact, error) {
 	log.Printf("[Worker: %s] Starting report generation for ID: %s (Type: %s)",
 		request.ID, request.ID, request.ReportType)
 
-	// Simulate CPU-intensive work or external API calls
-	delay := time.Duration(1+rand.Intn(5)) * time.Second // 1 to 5 seconds
-	select {
-	case <-time.After(delay):
-		// Continue processing
-	case <-ctx.Done():
-		log.Printf("[Worker: %s] Context cancelled during simulation for ID: %s",
-			request.ID, request.ID)
-		return "", ctx.Err() // Propagate context cancellation error
+	ctx, span := tracing.Start(ctx, "report.generate", trace.WithAttributes(tracing.ReportAttributes(request.ID, request.ReportType)...))
+	started := time.Now()
+	artifact, err := s.generators.Generate(ctx, request)
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
 	}
-
-	// Simulate random failure (e.g., database error, invalid parameters)
-	if rand.Intn(100) < 20 { // 20% chance of failure
-		log.Printf("[Worker: %s] Simulated failure for ID: %s", request.ID, request.ID)
-		return "", fmt.Errorf("simulated report generation error for ID %s", request.ID)
+	metrics.GenerationDuration.WithLabelValues(request.ReportType, outcome).Observe(time.Since(started).Seconds())
+	tracing.End(span, err)
+	if err != nil {
+		if generators.IsPermanent(err) {
+			log.Printf("[Worker: %s] Rejected request %s: %v", request.ID, request.ID, err)
+		} else {
+			log.Printf("[Worker: %s] Failed to generate report for ID %s: %v", request.ID, request.ID, err)
+		}
+		return nil, err
 	}
 
-	reportData := fmt.Sprintf("Report %s - Type: %s, Generated On: %s, Data: Random Value %d",
-		request.ID, request.ReportType, time.Now().Format(time.RFC3339), rand.Intn(1000))
+	log.Printf("[Worker: %s] Successfully generated %s report for ID: %s", request.ID, artifact.Format, request.ID)
+	return artifact, nil
+}
+
+// StoreArtifact uploads the artifact to the report store and returns the metadata kept in Redis
+func (s *ConsumerService) StoreArtifact(ctx context.Context, request models.ReportRequest, artifact *models.ReportArtifact) (*models.ArtifactMetadata, error) {
+	key := fmt.Sprintf("reports/%s/%s.%s", request.Tenant(), request.ID, strings.ToLower(string(artifact.Format)))
+	checksum := sha256.Sum256(artifact.Data)
+
+	ctx, span := tracing.Start(ctx, "report.store", trace.WithAttributes(tracing.ReportAttributes(request.ID, request.ReportType)...))
+	location, err := s.store.Put(ctx, key, artifact.ContentType, artifact.Data)
+	tracing.End(span, err)
+	if err != nil {
+		log.Printf("[Storage] Failed to store artifact for %s: %v", request.ID, err)
+		return nil, err
+	}
 
-	log.Printf("[Worker: %s] Successfully generated report for ID: %s", request.ID, request.ID)
-	return reportData, nil
+	log.Printf("[Storage] Stored artifact for %s at %s (%d bytes)", request.ID, location, len(artifact.Data))
+	return &models.ArtifactMetadata{
+		Store:       s.store.Name(),
+		Key:         key,
+		Location:    location,
+		Format:      artifact.Format,
+		ContentType: artifact.ContentType,
+		Size:        int64(len(artifact.Data)),
+		Checksum:    hex.EncodeToString(checksum[:]),
+	}, nil
 }
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestRequeueBackoff(t *testing.T) {
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{1, 500 * time.Millisecond},
+		{2, time.Second},
+		{4, 4 * time.Second},
+		{7, 30 * time.Second},
+		{1000, 30 * time.Second},
+	}
+	for _, test := range tests {
+		if got := requeueBackoff(test.failures); got != test.want {
+			t.Errorf("after %d failures: got %s, want %s", test.failures, got, test.want)
+		}
+	}
+}
+
+func TestHeartbeatAbortsTaskOnLostClaim(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	s := &ConsumerService{rdb: rdb, cfg: &config.Config{
+		Consumer: config.ConsumerConfig{ClaimLease: time.Minute},
+		Recovery: config.RecoveryConfig{HeartbeatInterval: 10 * time.Millisecond},
+	}}
+	if outcome, _, err := s.claimReport(ctx, "merchant-1", "report-1", "worker-1"); err != nil || outcome != claimAcquired {
+		t.Fatalf("got outcome %d (%v), want the claim acquired", outcome, err)
+	}
+
+	taskCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	go s.heartbeat(taskCtx, "merchant-1", "report-1", "worker-1", abort)
+
+	// Another worker took the report over after the lease expired
+	mr.Set(config.KEY_PREFIX_REPORT_CLAIM+"merchant-1:report-1", "worker-2")
+
+	select {
+	case <-taskCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("task was not aborted")
+	}
+	if cause := context.Cause(taskCtx); !errors.Is(cause, ErrClaimLost) {
+		t.Fatalf("got cause %v, want ErrClaimLost", cause)
+	}
+}
+
+func TestCountUnsupportedRequeue(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	s := &ConsumerService{rdb: rdb}
+
+	for want := int64(1); want <= 3; want++ {
+		if requeues, err := s.CountUnsupportedRequeue(ctx, "message-1"); err != nil || requeues != want {
+			t.Fatalf("got %d requeues (%v), want %d", requeues, err, want)
+		}
+	}
+	if requeues, err := s.CountUnsupportedRequeue(ctx, "message-2"); err != nil || requeues != 1 {
+		t.Fatalf("got %d requeues (%v) of another message, want 1", requeues, err)
+	}
+	if ttl := rdb.TTL(ctx, config.KEY_PREFIX_UNSUPPORTED_REQUEUES+"message-1").Val(); ttl <= 0 {
+		t.Fatalf("got TTL %s, want the count to expire", ttl)
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"coding_test_2/internal/models"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// Delivery is a report request delivery, validated and decoded once by the distributor
+type Delivery struct {
+	amqp.Delivery
+	Envelope models.Envelope
+	Request  models.ReportRequest
+}
+
+// DeliveryTracker keeps the unacknowledged delivery of every request handed to the workers,
+// shared by the distributor and the ack handler; deliveries are tracked by report key, see models.ReportKey
+type DeliveryTracker struct {
+	mu         sync.Mutex
+	deliveries map[string]Delivery
+}
+
+func NewDeliveryTracker() *DeliveryTracker {
+	return &DeliveryTracker{deliveries: make(map[string]Delivery)}
+}
+
+// Track stores the delivery of a request, replacing any earlier one
+func (t *DeliveryTracker) Track(report string, delivery Delivery) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.deliveries[report] = delivery
+}
+
+// Has reports whether a delivery of the request is tracked
+func (t *DeliveryTracker) Has(report string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.deliveries[report]
+	return ok
+}
+
+// Len returns the number of tracked deliveries
+func (t *DeliveryTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.deliveries)
+}
+
+// Take removes and returns the delivery of a request
+func (t *DeliveryTracker) Take(report string) (Delivery, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delivery, ok := t.deliveries[report]
+	delete(t.deliveries, report)
+	return delivery, ok
+}
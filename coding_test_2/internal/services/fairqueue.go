@@ -0,0 +1,95 @@
+package services
+
+// FairQueue buffers items per tenant and hands them out by smooth weighted round robin,
+// so a tenant with a large backlog cannot starve the others
+// Items of a tenant keep their order; it is not safe for concurrent use
+type FairQueue[T any] struct {
+	weight  func(tenant string) int
+	queues  map[string][]T
+	current map[string]int // Smooth weighted round robin state of tenants with items
+	size    int
+}
+
+// NewFairQueue creates an empty queue, weight returns the share of a tenant (at least 1)
+func NewFairQueue[T any](weight func(tenant string) int) *FairQueue[T] {
+	return &FairQueue[T]{
+		weight:  weight,
+		queues:  make(map[string][]T),
+		current: make(map[string]int),
+	}
+}
+
+// Len returns the number of buffered items
+func (q *FairQueue[T]) Len() int {
+	return q.size
+}
+
+// Push appends an item to the tenant's queue
+func (q *FairQueue[T]) Push(tenant string, item T) {
+	q.queues[tenant] = append(q.queues[tenant], item)
+	q.size++
+}
+
+// Next removes and returns the oldest item of the tenant whose turn it is
+// Tenants are offered in turn order to admit, a tenant it refuses (e.g. at its concurrency
+// cap) is skipped without losing its turn; ok is false if every tenant was refused
+func (q *FairQueue[T]) Next(admit func(tenant string, item T) bool) (item T, ok bool) {
+	refused := make(map[string]bool)
+	for {
+		chosen, total := "", 0
+		for tenant := range q.queues {
+			if refused[tenant] {
+				continue
+			}
+			total += q.weightOf(tenant)
+			if chosen == "" || q.current[tenant]+q.weightOf(tenant) > q.current[chosen]+q.weightOf(chosen) {
+				chosen = tenant
+			}
+		}
+		if chosen == "" {
+			return item, false
+		}
+
+		item = q.queues[chosen][0]
+		if !admit(chosen, item) {
+			refused[chosen] = true
+			continue
+		}
+
+		// Every admissible tenant earns its weight, the chosen one pays for all of them
+		for tenant := range q.queues {
+			if !refused[tenant] {
+				q.current[tenant] += q.weightOf(tenant)
+			}
+		}
+		q.current[chosen] -= total
+
+		q.queues[chosen] = q.queues[chosen][1:]
+		q.size--
+		if len(q.queues[chosen]) == 0 {
+			delete(q.queues, chosen)
+			delete(q.current, chosen)
+		}
+		return item, true
+	}
+}
+
+// Drain removes and returns every buffered item
+func (q *FairQueue[T]) Drain() []T {
+	items := make([]T, 0, q.size)
+	for tenant, queue := range q.queues {
+		items = append(items, queue...)
+		delete(q.queues, tenant)
+		delete(q.current, tenant)
+	}
+	q.size = 0
+	return items
+}
+
+// weightOf returns the weight of a tenant, at least 1
+func (q *FairQueue[T]) weightOf(tenant string) int {
+	if w := q.weight(tenant); w > 1 {
+		return w
+	}
+	return 1
+}
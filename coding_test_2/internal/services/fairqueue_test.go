@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+)
+
+func admitAll(string, string) bool { return true }
+
+func newTestQueue(weights map[string]int) *FairQueue[string] {
+	return NewFairQueue[string](func(tenant string) int { return weights[tenant] })
+}
+
+func TestFairQueueWeightRatios(t *testing.T) {
+	q := newTestQueue(map[string]int{"a": 3, "b": 1, "c": 0})
+	for i := 0; i < 40; i++ {
+		q.Push("a", fmt.Sprintf("a%d", i))
+		q.Push("b", fmt.Sprintf("b%d", i))
+		q.Push("c", fmt.Sprintf("c%d", i))
+	}
+
+	// Every round of 5 picks (the total weight, c counting as 1) serves each tenant its weight
+	for round := 0; round < 8; round++ {
+		counts := make(map[string]int)
+		for i := 0; i < 5; i++ {
+			item, ok := q.Next(admitAll)
+			if !ok {
+				t.Fatalf("round %d: queue refused with %d items left", round, q.Len())
+			}
+			counts[item[:1]]++
+		}
+		if counts["a"] != 3 || counts["b"] != 1 || counts["c"] != 1 {
+			t.Fatalf("round %d: got %v, want a:3 b:1 c:1", round, counts)
+		}
+	}
+}
+
+func TestFairQueueRefusedTenantKeepsTurn(t *testing.T) {
+	q := newTestQueue(map[string]int{"a": 2, "b": 1})
+	q.Push("a", "a0")
+	q.Push("a", "a1")
+	q.Push("b", "b0")
+	q.Push("b", "b1")
+
+	// a has the turn but is at its cap, b is served instead
+	item, ok := q.Next(func(tenant string, _ string) bool { return tenant != "a" })
+	if !ok || item != "b0" {
+		t.Fatalf("got %q (ok %v), want b0", item, ok)
+	}
+
+	// a kept its turn and its oldest item
+	item, ok = q.Next(admitAll)
+	if !ok || item != "a0" {
+		t.Fatalf("got %q (ok %v), want a0", item, ok)
+	}
+
+	// Nothing is handed out while every tenant is refused
+	if item, ok := q.Next(func(string, string) bool { return false }); ok {
+		t.Fatalf("got %q, want no item", item)
+	}
+	if q.Len() != 2 {
+		t.Fatalf("got %d items, want 2", q.Len())
+	}
+}
+
+func TestFairQueueKeepsTenantOrder(t *testing.T) {
+	q := newTestQueue(map[string]int{"a": 1, "b": 2})
+	for i := 0; i < 10; i++ {
+		q.Push("a", fmt.Sprintf("a%d", i))
+		q.Push("b", fmt.Sprintf("b%d", i))
+	}
+
+	next := map[string]int{"a": 0, "b": 0}
+	for q.Len() > 0 {
+		item, ok := q.Next(admitAll)
+		if !ok {
+			t.Fatalf("queue refused with %d items left", q.Len())
+		}
+		tenant := item[:1]
+		if want := fmt.Sprintf("%s%d", tenant, next[tenant]); item != want {
+			t.Fatalf("got %q, want %q", item, want)
+		}
+		next[tenant]++
+	}
+	if next["a"] != 10 || next["b"] != 10 {
+		t.Fatalf("got %v, want 10 items of each tenant", next)
+	}
+}
+
+func TestFairQueueDrain(t *testing.T) {
+	q := newTestQueue(map[string]int{})
+	q.Push("a", "a0")
+	q.Push("b", "b0")
+	q.Push("a", "a1")
+
+	if items := q.Drain(); len(items) != 3 {
+		t.Fatalf("got %v, want 3 items", items)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("got %d items after drain, want 0", q.Len())
+	}
+	if item, ok := q.Next(admitAll); ok {
+		t.Fatalf("got %q after drain, want no item", item)
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"coding_test_2/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// healthCheckTimeout bounds every health check, a check still running is reported as failed
+const healthCheckTimeout = 2 * time.Second
+
+// Lifecycle phases of the process, readiness passes only while serving
+const (
+	PhaseStarting = "starting"
+	PhaseServing  = "serving"
+	PhaseDraining = "draining"
+)
+
+// ErrNotServing is reported by readiness while the process is starting or draining
+var ErrNotServing = errors.New("not serving")
+
+// HealthCheck checks a single component, a nil error means it is healthy
+type HealthCheck func(ctx context.Context) error
+
+type HealthServiceInterface interface {
+	AddLivenessCheck(name string, check HealthCheck)
+	AddReadinessCheck(name string, check HealthCheck)
+	SetPhase(phase string)
+	Phase() string
+	Liveness(ctx context.Context) models.HealthReport
+	Readiness(ctx context.Context) models.HealthReport
+}
+
+// HealthService collects the checks behind the liveness and readiness endpoints
+// Liveness covers what only a restart fixes, readiness every dependency needed to serve;
+// readiness includes the liveness checks
+type HealthService struct {
+	mu        sync.Mutex
+	phase     string
+	liveness  map[string]HealthCheck
+	readiness map[string]HealthCheck
+}
+
+func NewHealthService() HealthServiceInterface {
+	return &HealthService{
+		phase:     PhaseStarting,
+		liveness:  make(map[string]HealthCheck),
+		readiness: make(map[string]HealthCheck),
+	}
+}
+
+// AddLivenessCheck registers a check failing liveness (and readiness), replacing one of the same name
+func (s *HealthService) AddLivenessCheck(name string, check HealthCheck) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.liveness[name] = check
+}
+
+// AddReadinessCheck registers a check failing readiness only, replacing one of the same name
+func (s *HealthService) AddReadinessCheck(name string, check HealthCheck) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readiness[name] = check
+}
+
+// SetPhase records the lifecycle phase of the process
+func (s *HealthService) SetPhase(phase string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.phase = phase
+}
+
+// Phase returns the lifecycle phase of the process
+func (s *HealthService) Phase() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.phase
+}
+
+// Liveness runs the liveness checks
+func (s *HealthService) Liveness(ctx context.Context) models.HealthReport {
+	s.mu.Lock()
+	checks := make(map[string]HealthCheck, len(s.liveness))
+	for name, check := range s.liveness {
+		checks[name] = check
+	}
+	phase := s.phase
+	s.mu.Unlock()
+
+	return runChecks(ctx, phase, checks)
+}
+
+// Readiness runs the liveness and readiness checks, it fails unless the process is serving
+func (s *HealthService) Readiness(ctx context.Context) models.HealthReport {
+	s.mu.Lock()
+	checks := make(map[string]HealthCheck, len(s.liveness)+len(s.readiness)+1)
+	for name, check := range s.liveness {
+		checks[name] = check
+	}
+	for name, check := range s.readiness {
+		checks[name] = check
+	}
+	phase := s.phase
+	s.mu.Unlock()
+
+	checks["phase"] = func(context.Context) error {
+		if phase != PhaseServing {
+			return fmt.Errorf("%w: %s", ErrNotServing, phase)
+		}
+		return nil
+	}
+	return runChecks(ctx, phase, checks)
+}
+
+// runChecks runs checks concurrently, each within healthCheckTimeout
+func runChecks(ctx context.Context, phase string, checks map[string]HealthCheck) models.HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	type outcome struct {
+		name string
+		err  error
+	}
+	outcomes := make(chan outcome, len(checks))
+	for name, check := range checks {
+		go func() {
+			outcomes <- outcome{name: name, err: check(ctx)}
+		}()
+	}
+
+	report := models.HealthReport{
+		Status: models.HealthOK,
+		Phase:  phase,
+		Checks: make(map[string]models.HealthCheckResult, len(checks)),
+	}
+	for range checks {
+		var result outcome
+		select {
+		case result = <-outcomes:
+		case <-ctx.Done():
+			// Report the checks that did not answer in time
+			for name := range checks {
+				if _, done := report.Checks[name]; !done {
+					report.Checks[name] = models.HealthCheckResult{Status: models.HealthFail, Error: "timed out"}
+				}
+			}
+			report.Status = models.HealthFail
+			return report
+		}
+
+		if result.err != nil {
+			report.Status = models.HealthFail
+			report.Checks[result.name] = models.HealthCheckResult{Status: models.HealthFail, Error: result.err.Error()}
+		} else {
+			report.Checks[result.name] = models.HealthCheckResult{Status: models.HealthOK}
+		}
+	}
+	return report
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// instanceName identifies this process in status histories and consumer groups
+func instanceName() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// recordTransition queues the append of a transition to the report's status history
+func recordTransition(ctx context.Context, pipe redis.Pipeliner, tenantID string, transition models.StatusTransition) error {
+	transitionJson, err := json.Marshal(transition)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transition for %s: %w", transition.RequestID, err)
+	}
+
+	key := config.KEY_PREFIX_REPORT_HISTORY + models.ReportKey(tenantID, transition.RequestID)
+	pipe.RPush(ctx, key, string(transitionJson))
+	pipe.Expire(ctx, key, 24*time.Hour) // TTL: 24 hours
+	return nil
+}
+
+// lastAttempt returns the attempt of the latest transition in the report's status history
+func lastAttempt(ctx context.Context, rdb redis.Cmdable, tenantID string, requestID string) (int, error) {
+	transitionJson, err := rdb.LIndex(ctx, config.KEY_PREFIX_REPORT_HISTORY+models.ReportKey(tenantID, requestID), -1).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var transition models.StatusTransition
+	if err := json.Unmarshal([]byte(transitionJson), &transition); err != nil {
+		return 0, fmt.Errorf("failed to parse history of %s: %w", requestID, err)
+	}
+	return transition.Attempt, nil
+}
+
+// readHistory returns every transition of the report's status history in order
+func readHistory(ctx context.Context, rdb redis.Cmdable, tenantID string, requestID string) ([]models.StatusTransition, error) {
+	entries, err := rdb.LRange(ctx, config.KEY_PREFIX_REPORT_HISTORY+models.ReportKey(tenantID, requestID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history of %s: %w", requestID, err)
+	}
+
+	transitions := make([]models.StatusTransition, 0, len(entries))
+	for _, entry := range entries {
+		var transition models.StatusTransition
+		if err := json.Unmarshal([]byte(entry), &transition); err != nil {
+			return nil, fmt.Errorf("failed to parse history of %s: %w", requestID, err)
+		}
+		transitions = append(transitions, transition)
+	}
+	return transitions, nil
+}
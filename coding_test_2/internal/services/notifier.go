@@ -0,0 +1,76 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type NotifierServiceInterface interface {
+	Subscribe(ctx context.Context, tenantID string, requestID string) (<-chan models.ReportResult, error)
+}
+
+type NotifierService struct {
+	rdb *redis.Client
+}
+
+func NewNotifierService(rdb *redis.Client) NotifierServiceInterface {
+	return &NotifierService{
+		rdb: rdb,
+	}
+}
+
+// Subscribe streams status transitions published by UpdateReportStatus
+// Only the tenant's reports are streamed, all of them if requestID is empty
+// The returned channel is closed once ctx is done or the subscription breaks
+func (s *NotifierService) Subscribe(ctx context.Context, tenantID string, requestID string) (<-chan models.ReportResult, error) {
+	pubsub := s.rdb.Subscribe(ctx, config.CHANNEL_REPORT_STATUS)
+
+	// Wait for the subscription confirmation so no transition is missed after returning
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", config.CHANNEL_REPORT_STATUS, err)
+	}
+
+	updates := make(chan models.ReportResult)
+
+	go func() {
+		defer close(updates)
+		defer pubsub.Close()
+
+		msgs := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+
+				var result models.ReportResult
+				if err := json.Unmarshal([]byte(msg.Payload), &result); err != nil {
+					log.Printf("[Notifier] Failed to parse status event: %v", err)
+					continue
+				}
+
+				if result.TenantID != tenantID || (requestID != "" && result.RequestID != requestID) {
+					continue
+				}
+
+				select {
+				case updates <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return updates, nil
+}
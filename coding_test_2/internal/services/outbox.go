@@ -0,0 +1,474 @@
+package services
+
+import (
+	"coding_test_2/internal/broker"
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/messages"
+	"coding_test_2/internal/metrics"
+	"coding_test_2/internal/models"
+	"coding_test_2/internal/tracing"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrReportExists is returned when submitting a request whose ID is already in use
+var ErrReportExists = errors.New("report already exists")
+
+type OutboxServiceInterface interface {
+	Submit(ctx context.Context, request models.ReportRequest) error
+	Relay(ctx context.Context) error
+	PublishOutcomes(ctx context.Context, requests []models.ReportRequest) (*models.PublishSummary, error)
+}
+
+// OutboxService implements a transactional outbox on a Redis stream
+// Submit records the request and its PENDING status atomically, Relay publishes
+// the recorded requests to RabbitMQ and removes them once confirmed by the broker
+// The broker's latest verdict on each request is kept for PublishOutcomes
+type OutboxService struct {
+	cfg      *config.Config
+	rdb      *redis.Client
+	broker   *broker.Connection
+	consumer string // Name of this relay within the consumer group
+}
+
+func NewOutboxService(cfg *config.Config, rdb *redis.Client, broker *broker.Connection) OutboxServiceInterface {
+	return &OutboxService{
+		cfg:      cfg,
+		rdb:      rdb,
+		broker:   broker,
+		consumer: instanceName(),
+	}
+}
+
+// Submit appends the request to the outbox and marks it PENDING in a single transaction
+func (s *OutboxService) Submit(ctx context.Context, request models.ReportRequest) error {
+	body, err := messages.EncodeReportRequest(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	resultJson, err := json.Marshal(models.ReportResult{
+		RequestID:   request.ID,
+		TenantID:    request.Tenant(),
+		Status:      models.StatusPending,
+		GeneratedAt: now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal status for %s: %w", request.ID, err)
+	}
+
+	key := config.KEY_PREFIX_REPORT_STATUS + request.Key()
+	err = s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrReportExists
+		}
+
+		values := map[string]interface{}{
+			"request_id":  request.ID,
+			"tenant_id":   request.Tenant(),
+			"report_type": request.ReportType,
+			"priority":    request.Priority,
+			"payload":     string(body),
+		}
+		// The relay publishes the request later, carry the submitter's trace context to it
+		tracing.Inject(ctx, tracing.Fields(values))
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: config.KEY_OUTBOX_STREAM,
+				Values: values,
+			})
+			pipe.Set(ctx, key, string(resultJson), 24*time.Hour) // TTL: 24 hours
+			pipe.Publish(ctx, config.CHANNEL_REPORT_STATUS, string(resultJson))
+			return recordTransition(ctx, pipe, request.Tenant(), models.StatusTransition{
+				RequestID: request.ID,
+				To:        models.StatusPending,
+				At:        now,
+				Worker:    s.consumer,
+			})
+		})
+		return err
+	}, key)
+	if err != nil {
+		if !errors.Is(err, ErrReportExists) {
+			log.Printf("[Outbox] Failed to submit request %s: %v", request.ID, err)
+		}
+		return err
+	}
+
+	log.Printf("[Outbox] Submitted request: %s (Type: %s)", request.ID, request.ReportType)
+	return nil
+}
+
+// Relay publishes outbox entries to RabbitMQ until ctx is cancelled
+// Entries are acknowledged and deleted only once the broker confirms them; nacked,
+// returned or unconfirmed entries stay pending and are claimed again after ClaimIdle,
+// including those left behind by a relay that crashed, so delivery is at-least-once
+// Entries still unconfirmed after MaxDeliveries attempts are dead-lettered, see claimPending
+func (s *OutboxService) Relay(ctx context.Context) error {
+	log.Println("[Outbox] Relay started")
+	defer log.Println("[Outbox] Relay stopped")
+
+	err := s.rdb.XGroupCreateMkStream(ctx, config.KEY_OUTBOX_STREAM, config.OUTBOX_CONSUMER_GROUP, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create outbox consumer group: %w", err)
+	}
+
+	claimTicker := time.NewTicker(s.cfg.Outbox.ClaimIdle / 2)
+	defer claimTicker.Stop()
+
+	// Each tick claims the next batch of the pending entries, the cursor wraps around to
+	// the start of the stream once the scan reached its end
+	cursor := "0-0"
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-claimTicker.C:
+			// Retry entries that were not confirmed in time
+			var entries []redis.XMessage
+			entries, cursor = s.claimPending(ctx, cursor)
+			s.relayBatch(ctx, entries)
+		default:
+		}
+
+		streams, err := s.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    config.OUTBOX_CONSUMER_GROUP,
+			Consumer: s.consumer,
+			Streams:  []string{config.KEY_OUTBOX_STREAM, ">"},
+			Count:    int64(s.cfg.Outbox.BatchSize),
+			Block:    s.cfg.Outbox.PollInterval,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("[Outbox] Failed to read entries: %v", err)
+			select {
+			case <-time.After(s.cfg.Outbox.PollInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			s.relayBatch(ctx, stream.Messages)
+		}
+	}
+}
+
+// claimPending claims a batch of the entries left unconfirmed for ClaimIdle from cursor on
+// Entries delivered more than MaxDeliveries times are dead-lettered instead of returned
+// It returns the cursor the next claim continues from
+func (s *OutboxService) claimPending(ctx context.Context, cursor string) ([]redis.XMessage, string) {
+	entries, next, err := xAutoClaim(ctx, s.rdb, s.consumer, s.cfg.Outbox.ClaimIdle, cursor, s.cfg.Outbox.BatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[Outbox] Failed to claim pending entries: %v", err)
+		}
+		return nil, cursor
+	}
+	if len(entries) == 0 {
+		return nil, next
+	}
+
+	// The claim counted as a delivery already
+	pending, err := s.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   config.KEY_OUTBOX_STREAM,
+		Group:    config.OUTBOX_CONSUMER_GROUP,
+		Start:    entries[0].ID,
+		End:      entries[len(entries)-1].ID,
+		Count:    int64(len(entries)),
+		Consumer: s.consumer,
+	}).Result()
+	if err != nil {
+		// Relay them regardless, the count is checked again on the next claim
+		log.Printf("[Outbox] Failed to get delivery counts of pending entries: %v", err)
+		return entries, next
+	}
+	deliveries := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		deliveries[p.ID] = p.RetryCount
+	}
+
+	relay := entries[:0]
+	for _, entry := range entries {
+		if attempts := deliveries[entry.ID] - 1; attempts >= int64(s.cfg.Outbox.MaxDeliveries) {
+			s.deadLetter(ctx, entry, attempts)
+			continue
+		}
+		relay = append(relay, entry)
+	}
+	return relay, next
+}
+
+// xAutoClaim claims up to count outbox entries idle for minIdle from start on and returns
+// them with the cursor to continue from
+// The client's XAutoClaim expects the two element reply of Redis 6.2 and fails on the
+// three elements of Redis 7 (which adds the IDs of deleted entries), so it is parsed here
+func xAutoClaim(ctx context.Context, rdb *redis.Client, consumer string, minIdle time.Duration, start string, count int) ([]redis.XMessage, string, error) {
+	reply, err := rdb.Do(ctx, "XAUTOCLAIM", config.KEY_OUTBOX_STREAM, config.OUTBOX_CONSUMER_GROUP, consumer,
+		minIdle.Milliseconds(), start, "COUNT", count).Slice()
+	if err != nil {
+		return nil, start, err
+	}
+	if len(reply) < 2 {
+		return nil, start, fmt.Errorf("unexpected XAUTOCLAIM reply of %d elements", len(reply))
+	}
+	next, _ := reply[0].(string)
+	claimed, _ := reply[1].([]interface{})
+
+	entries := make([]redis.XMessage, 0, len(claimed))
+	for _, c := range claimed {
+		entry, _ := c.([]interface{})
+		if len(entry) != 2 {
+			continue
+		}
+		id, _ := entry[0].(string)
+		fields, _ := entry[1].([]interface{})
+		if fields == nil {
+			continue // Deleted while pending, nothing left to relay
+		}
+		values := make(map[string]interface{}, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			key, _ := fields[i].(string)
+			values[key] = fields[i+1]
+		}
+		entries = append(entries, redis.XMessage{ID: id, Values: values})
+	}
+	return entries, next, nil
+}
+
+// deadLetter moves an entry that was relayed attempts times without confirmation to
+// KEY_OUTBOX_DEAD_LETTER_STREAM and marks its report FAILED
+func (s *OutboxService) deadLetter(ctx context.Context, entry redis.XMessage, attempts int64) {
+	tenantID, requestID := entryReport(entry)
+	reportType, _ := entry.Values["report_type"].(string)
+
+	values := make(map[string]interface{}, len(entry.Values)+2)
+	for key, value := range entry.Values {
+		values[key] = value
+	}
+	values["outbox_id"] = entry.ID
+	values["attempts"] = attempts
+
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: config.KEY_OUTBOX_DEAD_LETTER_STREAM, Values: values})
+		pipe.XAck(ctx, config.KEY_OUTBOX_STREAM, config.OUTBOX_CONSUMER_GROUP, entry.ID)
+		pipe.XDel(ctx, config.KEY_OUTBOX_STREAM, entry.ID)
+		return recordPublishOutcome(ctx, pipe, tenantID, requestID, models.PublishDeadLettered, fmt.Errorf("not confirmed after %d attempts", attempts))
+	})
+	if err != nil {
+		log.Printf("[Outbox] Failed to dead-letter request %s: %v", requestID, err)
+		return
+	}
+	metrics.DeadLettered.WithLabelValues(reportType).Inc()
+	log.Printf("[Outbox] Request %s not confirmed after %d attempts, dead-lettered", requestID, attempts)
+
+	// A report cancelled in the meantime keeps its status
+	_, err = updateReportStatus(ctx, s.rdb, s.consumer, tenantID, requestID, models.StatusFailed, nil,
+		fmt.Sprintf("not confirmed by RabbitMQ after %d publish attempts", attempts))
+	if err != nil && !errors.Is(err, models.ErrInvalidTransition) {
+		log.Printf("[Outbox] Failed to mark dead-lettered request %s FAILED: %v", requestID, err)
+	}
+}
+
+// relayBatch publishes the entries and acknowledges those confirmed by the broker
+func (s *OutboxService) relayBatch(ctx context.Context, entries []redis.XMessage) {
+	type inFlight struct {
+		entryID    string
+		tenantID   string
+		requestID  string
+		reportType string
+		confirm    <-chan broker.PublishResult
+		span       trace.Span
+	}
+	var published []inFlight
+	unconfirmed := make(map[string]trace.Span) // Publish span by entry ID, removed once ended
+	defer func() {
+		// Ends the spans of publishes left unconfirmed on cancellation
+		for _, span := range unconfirmed {
+			span.End()
+		}
+	}()
+
+	for _, entry := range entries {
+		tenantID, requestID := entryReport(entry)
+		reportType, _ := entry.Values["report_type"].(string)
+		payload, _ := entry.Values["payload"].(string)
+		priority, _ := strconv.Atoi(fmt.Sprint(entry.Values["priority"])) // Entries without one are published at 0
+
+		// Continue the trace of the submission, the consumer picks it up from the headers
+		publishCtx, span := tracing.Start(tracing.Extract(ctx, tracing.Fields(entry.Values)), "report.publish",
+			trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(tracing.ReportAttributes(requestID, reportType)...))
+
+		confirm, err := s.broker.Publish(
+			publishCtx,
+			s.cfg.RabbitMQ.Exchange,               // exchange
+			s.cfg.RabbitMQ.RoutingKey(reportType), // routing key
+			amqp.Publishing{
+				Headers:      tracing.InjectAMQP(publishCtx, nil),
+				DeliveryMode: amqp.Persistent, // Make message persistent
+				ContentType:  "application/json",
+				Type:         models.MessageTypeReportRequest,
+				MessageId:    requestID, // Correlates confirms and returns
+				Priority:     uint8(priority),
+				Body:         []byte(payload),
+			},
+		)
+		if err != nil {
+			log.Printf("[Outbox] Failed to publish request %s: %v", requestID, err)
+			metrics.RabbitMQErrors.WithLabelValues("publish").Inc()
+			tracing.End(span, err)
+			s.recordPublishOutcome(ctx, tenantID, requestID, models.PublishFailed, err)
+			continue
+		}
+		published = append(published, inFlight{entryID: entry.ID, tenantID: tenantID, requestID: requestID, reportType: reportType, confirm: confirm, span: span})
+		unconfirmed[entry.ID] = span
+	}
+
+	for _, p := range published {
+		var result broker.PublishResult
+		select {
+		case result = <-p.confirm:
+		case <-ctx.Done():
+			return
+		}
+		delete(unconfirmed, p.entryID)
+
+		if result.Err != nil || result.Outcome != broker.OutcomeConfirmed {
+			log.Printf("[Outbox] Request %s not confirmed (outcome: %s, error: %v), will retry",
+				p.requestID, result.Outcome, result.Err)
+			metrics.RabbitMQErrors.WithLabelValues("confirm").Inc()
+			err := fmt.Errorf("not confirmed (outcome: %s, error: %v)", result.Outcome, result.Err)
+			tracing.End(p.span, err)
+
+			outcome := models.PublishFailed
+			switch {
+			case result.Err != nil:
+			case result.Outcome == broker.OutcomeNacked:
+				outcome = models.PublishNacked
+			case result.Outcome == broker.OutcomeReturned:
+				outcome = models.PublishReturned
+			}
+			s.recordPublishOutcome(ctx, p.tenantID, p.requestID, outcome, err)
+			continue
+		}
+		metrics.Published.WithLabelValues(p.reportType).Inc()
+		p.span.End()
+
+		_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.XAck(ctx, config.KEY_OUTBOX_STREAM, config.OUTBOX_CONSUMER_GROUP, p.entryID)
+			pipe.XDel(ctx, config.KEY_OUTBOX_STREAM, p.entryID)
+			return recordPublishOutcome(ctx, pipe, p.tenantID, p.requestID, models.PublishConfirmed, nil)
+		})
+		if err != nil {
+			// The entry will be relayed again, consumers must tolerate the duplicate
+			log.Printf("[Outbox] Failed to mark request %s as sent: %v", p.requestID, err)
+			continue
+		}
+
+		log.Printf("[Outbox] Relayed request: %s", p.requestID)
+	}
+}
+
+// PublishOutcomes returns the broker's latest verdict on each of the report requests
+// Requests the relay did not publish yet are reported as pending
+func (s *OutboxService) PublishOutcomes(ctx context.Context, requests []models.ReportRequest) (*models.PublishSummary, error) {
+	summary := &models.PublishSummary{}
+	if len(requests) == 0 {
+		return summary, nil
+	}
+
+	keys := make([]string, len(requests))
+	for i, request := range requests {
+		keys[i] = config.KEY_PREFIX_PUBLISH_OUTCOME + request.Key()
+	}
+	values, err := s.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get publish outcomes: %w", err)
+	}
+
+	for i, value := range values {
+		requestID := requests[i].ID
+		recordJson, ok := value.(string)
+		if !ok {
+			summary.Pending = append(summary.Pending, requestID)
+			continue
+		}
+		var record models.PublishRecord
+		if err := json.Unmarshal([]byte(recordJson), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse publish outcome of %s: %w", requestID, err)
+		}
+
+		switch record.Outcome {
+		case models.PublishConfirmed:
+			summary.Confirmed = append(summary.Confirmed, requestID)
+		case models.PublishNacked:
+			summary.Nacked = append(summary.Nacked, requestID)
+		case models.PublishReturned:
+			summary.Returned = append(summary.Returned, requestID)
+		case models.PublishDeadLettered:
+			summary.DeadLettered = append(summary.DeadLettered, requestID)
+		default:
+			summary.Failed = append(summary.Failed, requestID)
+		}
+	}
+	return summary, nil
+}
+
+// recordPublishOutcome keeps the broker's latest verdict on a request, failures are logged
+// The relay retries the request regardless, the record only serves PublishOutcomes
+func (s *OutboxService) recordPublishOutcome(ctx context.Context, tenantID string, requestID string, outcome models.PublishOutcome, cause error) {
+	if err := recordPublishOutcome(ctx, s.rdb, tenantID, requestID, outcome, cause); err != nil {
+		log.Printf("[Outbox] Failed to record publish outcome of %s: %v", requestID, err)
+	}
+}
+
+// recordPublishOutcome stores the publish outcome of a request with the TTL of its status
+func recordPublishOutcome(ctx context.Context, rdb redis.Cmdable, tenantID string, requestID string, outcome models.PublishOutcome, cause error) error {
+	record := models.PublishRecord{
+		RequestID: requestID,
+		Outcome:   outcome,
+		At:        time.Now().UTC(),
+	}
+	if cause != nil {
+		record.Error = cause.Error()
+	}
+	recordJson, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal publish outcome of %s: %w", requestID, err)
+	}
+	return rdb.Set(ctx, config.KEY_PREFIX_PUBLISH_OUTCOME+models.ReportKey(tenantID, requestID), string(recordJson), 24*time.Hour).Err() // TTL: 24 hours
+}
+
+// entryReport returns the tenant and request ID of an outbox entry, entries added before
+// tenants were recorded belong to the default tenant
+func entryReport(entry redis.XMessage) (tenantID string, requestID string) {
+	requestID, _ = entry.Values["request_id"].(string)
+	tenantID, _ = entry.Values["tenant_id"].(string)
+	if tenantID == "" {
+		tenantID = models.DefaultTenant
+	}
+	return tenantID, requestID
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/models"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestOutbox returns an outbox whose entries were read once by its relay, as if their
+// publish was not confirmed; a zero ClaimIdle lets every claim take them back right away
+func newTestOutbox(t *testing.T, outbox config.OutboxConfig, requestIDs ...string) *OutboxService {
+	t.Helper()
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	s := &OutboxService{cfg: &config.Config{Outbox: outbox}, rdb: rdb, consumer: "relay-1"}
+	if err := rdb.XGroupCreateMkStream(ctx, config.KEY_OUTBOX_STREAM, config.OUTBOX_CONSUMER_GROUP, "0").Err(); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	for _, requestID := range requestIDs {
+		if err := s.Submit(ctx, models.ReportRequest{ID: requestID, ReportType: "sales"}); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	if len(requestIDs) == 0 {
+		return s
+	}
+	err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    config.OUTBOX_CONSUMER_GROUP,
+		Consumer: s.consumer,
+		Streams:  []string{config.KEY_OUTBOX_STREAM, ">"},
+		Block:    -1, // The entries are there, do not block
+	}).Err()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return s
+}
+
+// claimedIDs returns the request IDs of the claimed entries
+func claimedIDs(entries []redis.XMessage) []string {
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.Values["request_id"].(string))
+	}
+	return ids
+}
+
+func TestOutboxClaimPendingDeadLettersExhaustedEntries(t *testing.T) {
+	ctx := context.Background()
+	s := newTestOutbox(t, config.OutboxConfig{BatchSize: 10, MaxDeliveries: 2}, "report-1")
+
+	// Relayed once by the read, a second time after this claim
+	entries, _ := s.claimPending(ctx, "0-0")
+	if ids := claimedIDs(entries); len(ids) != 1 || ids[0] != "report-1" {
+		t.Fatalf("got %v, want report-1 claimed", ids)
+	}
+
+	// Both attempts used up, the entry moves to the dead-letter stream
+	entries, _ = s.claimPending(ctx, "0-0")
+	if len(entries) != 0 {
+		t.Fatalf("got %v, want nothing claimed", claimedIDs(entries))
+	}
+	if n := s.rdb.XLen(ctx, config.KEY_OUTBOX_STREAM).Val(); n != 0 {
+		t.Fatalf("got %d outbox entries, want 0", n)
+	}
+	dead, err := s.rdb.XRange(ctx, config.KEY_OUTBOX_DEAD_LETTER_STREAM, "-", "+").Result()
+	if err != nil || len(dead) != 1 || dead[0].Values["request_id"] != "report-1" || dead[0].Values["attempts"] != "2" {
+		t.Fatalf("got dead letters %v (%v), want report-1 after 2 attempts", dead, err)
+	}
+	if pending := s.rdb.XPending(ctx, config.KEY_OUTBOX_STREAM, config.OUTBOX_CONSUMER_GROUP).Val(); pending.Count != 0 {
+		t.Fatalf("got %d pending entries, want 0", pending.Count)
+	}
+	if status, err := readStatus(ctx, s.rdb, config.KEY_PREFIX_REPORT_STATUS+models.ReportKey(models.DefaultTenant, "report-1")); err != nil || status != models.StatusFailed {
+		t.Fatalf("got status %s (%v), want FAILED", status, err)
+	}
+	if publish, err := s.PublishOutcomes(ctx, []models.ReportRequest{{ID: "report-1"}}); err != nil || len(publish.DeadLettered) != 1 || !publish.Settled() {
+		t.Fatalf("got outcomes %+v (%v), want report-1 dead-lettered", publish, err)
+	}
+}
+
+func TestOutboxPublishOutcomes(t *testing.T) {
+	ctx := context.Background()
+	s := newTestOutbox(t, config.OutboxConfig{BatchSize: 10, MaxDeliveries: 5})
+
+	s.recordPublishOutcome(ctx, models.DefaultTenant, "report-1", models.PublishConfirmed, nil)
+	s.recordPublishOutcome(ctx, models.DefaultTenant, "report-2", models.PublishNacked, errors.New("nacked"))
+	s.recordPublishOutcome(ctx, models.DefaultTenant, "report-3", models.PublishReturned, errors.New("returned"))
+	s.recordPublishOutcome(ctx, models.DefaultTenant, "report-4", models.PublishFailed, errors.New("connection closed"))
+
+	publish, err := s.PublishOutcomes(ctx, []models.ReportRequest{{ID: "report-1"}, {ID: "report-2"}, {ID: "report-3"}, {ID: "report-4"}, {ID: "report-5"}})
+	if err != nil {
+		t.Fatalf("publish outcomes: %v", err)
+	}
+	want := models.PublishSummary{
+		Confirmed: []string{"report-1"},
+		Nacked:    []string{"report-2"},
+		Returned:  []string{"report-3"},
+		Failed:    []string{"report-4"},
+		Pending:   []string{"report-5"},
+	}
+	if !reflect.DeepEqual(*publish, want) || publish.Settled() {
+		t.Fatalf("got %+v, want %+v unsettled", *publish, want)
+	}
+
+	// A later confirmation replaces the earlier verdict
+	s.recordPublishOutcome(ctx, models.DefaultTenant, "report-2", models.PublishConfirmed, nil)
+	if publish, err = s.PublishOutcomes(ctx, []models.ReportRequest{{ID: "report-1"}, {ID: "report-2"}}); err != nil || len(publish.Confirmed) != 2 || !publish.Settled() {
+		t.Fatalf("got %+v (%v), want both confirmed", publish, err)
+	}
+}
+
+func TestOutboxClaimPendingKeepsCursor(t *testing.T) {
+	ctx := context.Background()
+	s := newTestOutbox(t, config.OutboxConfig{BatchSize: 1, MaxDeliveries: 10}, "report-1", "report-2", "report-3")
+
+	entries, cursor := s.claimPending(ctx, "0-0")
+	if ids := claimedIDs(entries); len(ids) != 1 || ids[0] != "report-1" || cursor == "0-0" {
+		t.Fatalf("got %v with cursor %s, want report-1 and a cursor past it", ids, cursor)
+	}
+
+	// Later claims continue after the previous batch until the cursor wraps around
+	for i := 0; cursor != "0-0"; i++ {
+		if i == 3 {
+			t.Fatal("cursor did not wrap around")
+		}
+		entries, cursor = s.claimPending(ctx, cursor)
+		if ids := claimedIDs(entries); len(ids) != 1 || ids[0] == "report-1" {
+			t.Fatalf("got %v, want the next entry", ids)
+		}
+	}
+	if entries, _ = s.claimPending(ctx, cursor); len(entries) != 1 || claimedIDs(entries)[0] != "report-1" {
+		t.Fatalf("got %v after wrapping around, want report-1", claimedIDs(entries))
+	}
+}
+
+func TestOutboxPublishOutcomesByTenant(t *testing.T) {
+	ctx := context.Background()
+	s := newTestOutbox(t, config.OutboxConfig{BatchSize: 10, MaxDeliveries: 5})
+
+	s.recordPublishOutcome(ctx, "merchant-1", "report-1", models.PublishConfirmed, nil)
+
+	publish, err := s.PublishOutcomes(ctx, []models.ReportRequest{{ID: "report-1", TenantID: "merchant-2"}})
+	if err != nil || len(publish.Pending) != 1 {
+		t.Fatalf("got %+v (%v), want the other tenant's report-1 pending", publish, err)
+	}
+}
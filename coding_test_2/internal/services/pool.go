@@ -0,0 +1,98 @@
+package services
+
+import (
+	"coding_test_2/internal/models"
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// WorkerPool runs ReportWorkers over a shared delivery channel and can be resized at runtime
+// Retired workers finish their current task first, so no delivery is dropped or handled twice
+type WorkerPool struct {
+	ctx        context.Context
+	wg         *sync.WaitGroup
+	consumer   ConsumerServiceInterface
+	reportType string // Report type of the deliveries, part of the worker names
+	msgs       <-chan Delivery
+	results    chan<- models.ReportResult
+
+	running sync.WaitGroup // Workers that have not returned yet, retired ones included
+	alive   atomic.Int32   // Number of workers that have not returned yet
+
+	mu       sync.Mutex
+	stops    []chan struct{} // One per running worker, closed to retire it
+	lastID   int
+	onResize func(size int) error
+}
+
+// NewWorkerPool creates an empty pool, onResize (optional) is called after every resize
+func NewWorkerPool(ctx context.Context, wg *sync.WaitGroup, consumer ConsumerServiceInterface, reportType string, msgs <-chan Delivery, results chan<- models.ReportResult, onResize func(size int) error) *WorkerPool {
+	return &WorkerPool{
+		ctx:        ctx,
+		wg:         wg,
+		consumer:   consumer,
+		reportType: reportType,
+		msgs:       msgs,
+		results:    results,
+		onResize:   onResize,
+	}
+}
+
+// Size returns the number of running workers
+func (p *WorkerPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+// Alive returns the number of workers that have not returned, retiring ones included
+func (p *WorkerPool) Alive() int {
+	return int(p.alive.Load())
+}
+
+// Wait blocks until every worker started by the pool has returned
+func (p *WorkerPool) Wait() {
+	p.running.Wait()
+}
+
+// Resize starts or retires workers until size workers are running
+func (p *WorkerPool) Resize(size int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	current := len(p.stops)
+	if size == current {
+		return nil
+	}
+
+	for len(p.stops) < size {
+		p.lastID++
+		stop := make(chan struct{})
+		p.stops = append(p.stops, stop)
+
+		p.wg.Add(1)
+		p.running.Add(1)
+		p.alive.Add(1)
+		go func(workerID int) {
+			defer p.wg.Done()
+			defer p.running.Done()
+			defer p.alive.Add(-1)
+			p.consumer.ReportWorker(p.ctx, p.reportType, workerID, stop, p.msgs, p.results)
+		}(p.lastID)
+	}
+
+	for len(p.stops) > size {
+		last := len(p.stops) - 1
+		close(p.stops[last])
+		p.stops = p.stops[:last]
+	}
+
+	log.Printf("[WorkerPool] Resized %s from %d to %d workers", p.reportType, current, size)
+
+	if p.onResize != nil {
+		return p.onResize(size)
+	}
+	return nil
+}
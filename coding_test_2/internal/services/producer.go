@@ -3,46 +3,56 @@ package services
 import (
 	"coding_test_2/internal/config"
 	"coding_test_2/internal/models"
+	"coding_test_2/internal/tracing"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 
-	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ProducerInterface interface {
-	ProduceReportRequests(ctx context.Context, wg *sync.WaitGroup) error
+	ProduceReportRequests(ctx context.Context, wg *sync.WaitGroup) (*models.SubmitSummary, error)
 }
 
 type ProducerService struct {
-	ch *amqp.Channel
+	cfg    *config.Config
+	outbox OutboxServiceInterface
 }
 
-func NewProducerService(ch *amqp.Channel) ProducerInterface {
+func NewProducerService(cfg *config.Config, outbox OutboxServiceInterface) ProducerInterface {
 	return &ProducerService{
-		ch: ch,
+		cfg:    cfg,
+		outbox: outbox,
 	}
 }
 
-// produceReportRequests creates and publishes report requests to RabbitMQ
-func (s *ProducerService) ProduceReportRequests(ctx context.Context, wg *sync.WaitGroup) error {
+// produceReportRequests creates report requests and submits them through the outbox
+// The outbox records each request as PENDING and its relay publishes it to RabbitMQ,
+// the summary reports which request IDs were submitted, already existed or failed, and
+// which of the submitted ones the broker confirmed, nacked or returned, see awaitPublished
+func (s *ProducerService) ProduceReportRequests(ctx context.Context, wg *sync.WaitGroup) (*models.SubmitSummary, error) {
 	log.Println("[Producer] Starting to produce report requests...")
 
 	reportTypes := []string{"sales", "inventory", "financial", "user_activity"}
+	tenants := []string{"merchant-1", "merchant-1", "merchant-2"} // merchant-1 submits the bulk of the requests
+	summary := &models.SubmitSummary{}
+	var submitted []models.ReportRequest // Awaited by awaitPublished
 
-	for i := 0; i < config.NUM_PRODUCER_REQUESTS; i++ {
+	for i := 0; i < s.cfg.Producer.NumRequests; i++ {
 		select {
 		case <-ctx.Done():
 			log.Println("[Producer] Context cancelled, stopping production")
-			return ctx.Err()
+			return summary, ctx.Err()
 		default:
 		}
 
 		request := models.ReportRequest{
 			ID:         fmt.Sprintf("report-%d", i+1),
+			TenantID:   tenants[i%len(tenants)],
 			ReportType: reportTypes[i%len(reportTypes)],
 			Parameters: map[string]string{
 				"start_date": "2024-01-01",
@@ -51,40 +61,68 @@ func (s *ProducerService) ProduceReportRequests(ctx context.Context, wg *sync.Wa
 			},
 			CreatedAt: time.Now(),
 		}
+		request.Priority = s.cfg.Priority.ForType(request.ReportType)
 
-		body, err := json.Marshal(request)
-		if err != nil {
-			log.Printf("[Producer] Failed to marshal request %s: %v", request.ID, err)
-			continue
+		// Each request starts a trace, the relay continues it from the outbox entry
+		submitCtx, span := tracing.Start(ctx, "report.submit",
+			trace.WithAttributes(tracing.ReportAttributes(request.ID, request.ReportType)...))
+		err := s.outbox.Submit(submitCtx, request)
+		tracing.End(span, err)
+
+		switch {
+		case errors.Is(err, ErrReportExists):
+			log.Printf("[Producer] Request %s exists already, skipping", request.ID)
+			summary.Existing = append(summary.Existing, request.ID)
+		case err != nil:
+			log.Printf("[Producer] Failed to submit request %s: %v", request.ID, err)
+			summary.Failed = append(summary.Failed, request.ID)
+		default:
+			log.Printf("[Producer] Submitted request: %s (Type: %s, Tenant: %s)", request.ID, request.ReportType, request.TenantID)
+			summary.Submitted = append(summary.Submitted, request.ID)
+			submitted = append(submitted, request)
 		}
 
-		err = s.ch.Publish(
-			"",                // exchange
-			config.QUEUE_NAME, // routing key
-			false,             // mandatory
-			false,             // immediate
-			amqp.Publishing{
-				DeliveryMode: amqp.Persistent, // Make message persistent
-				ContentType:  "application/json",
-				Body:         body,
-			},
-		)
+		// Wait before sending next message
+		select {
+		case <-time.After(s.cfg.Producer.PublishInterval):
+		case <-ctx.Done():
+			return summary, ctx.Err()
+		}
+	}
 
+	log.Printf("[Producer] Finished producing %d report requests: %d submitted, %d existing, %d failed",
+		s.cfg.Producer.NumRequests, len(summary.Submitted), len(summary.Existing), len(summary.Failed))
+
+	publish, err := s.awaitPublished(ctx, submitted)
+	summary.Publish = publish
+	if publish != nil {
+		log.Printf("[Producer] Broker outcomes: %d confirmed, %d nacked, %d returned, %d failed, %d dead-lettered, %d pending",
+			len(publish.Confirmed), len(publish.Nacked), len(publish.Returned), len(publish.Failed), len(publish.DeadLettered), len(publish.Pending))
+	}
+	return summary, err
+}
+
+// awaitPublished waits up to ConfirmTimeout for the outbox relay to settle the requests,
+// i.e. for the broker to confirm them or the relay to dead-letter them, and returns their
+// latest outcomes; requests still nacked, returned or pending are retried by the relay
+func (s *ProducerService) awaitPublished(ctx context.Context, requests []models.ReportRequest) (*models.PublishSummary, error) {
+	deadline := time.Now().Add(s.cfg.Producer.ConfirmTimeout)
+	ticker := time.NewTicker(s.cfg.Outbox.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		publish, err := s.outbox.PublishOutcomes(ctx, requests)
+		if (err == nil && publish.Settled()) || !time.Now().Before(deadline) {
+			return publish, err
+		}
 		if err != nil {
-			log.Printf("[Producer] Failed to publish request %s: %v", request.ID, err)
-			continue
+			log.Printf("[Producer] %v", err)
 		}
 
-		log.Printf("[Producer] Published request: %s (Type: %s)", request.ID, request.ReportType)
-
-		// Wait before sending next message
 		select {
-		case <-time.After(config.PUBLISH_INTERVAL):
+		case <-ticker.C:
 		case <-ctx.Done():
-			return ctx.Err()
+			return publish, ctx.Err()
 		}
 	}
-
-	log.Printf("[Producer] Finished producing %d report requests", config.NUM_PRODUCER_REQUESTS)
-	return nil
 }
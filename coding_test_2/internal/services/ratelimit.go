@@ -0,0 +1,181 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrRateLimited is wrapped by every RateLimitError
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimitError is returned when a submission exceeds the rate limit or the daily quota
+type RateLimitError struct {
+	TenantID   string
+	ReportType string
+	Limit      string        // "rate" or "daily_quota"
+	RetryAfter time.Duration // When the submission would be accepted
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: %s of tenant %s exceeded for %s reports, retry after %s",
+		ErrRateLimited, e.Limit, e.TenantID, e.ReportType, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// rateLimitScript checks the daily quota, then the rate by GCRA, and records the submission
+// only if both allow it; it returns {0, "", 0} or {1, limit, retry after in ms}
+// KEYS[1] GCRA key, KEYS[2] quota key, ARGV[1] now in ms, ARGV[2] emission interval in ms
+// (0 disables the rate), ARGV[3] burst, ARGV[4] quota (0 disables it), ARGV[5] ms until the quota resets
+var rateLimitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local quota = tonumber(ARGV[4])
+
+if quota > 0 and (tonumber(redis.call('GET', KEYS[2])) or 0) >= quota then
+	return {1, 'daily_quota', tonumber(ARGV[5])}
+end
+
+if interval > 0 then
+	local tat = math.max(tonumber(redis.call('GET', KEYS[1])) or now, now)
+	local allow_at = tat + interval - interval * tonumber(ARGV[3])
+	if allow_at > now then
+		return {1, 'rate', allow_at - now}
+	end
+	redis.call('SET', KEYS[1], tat + interval, 'PX', tat + interval - now)
+end
+
+if quota > 0 then
+	redis.call('INCR', KEYS[2])
+	redis.call('PEXPIRE', KEYS[2], ARGV[5])
+end
+return {0, '', 0}
+`)
+
+// refundScript takes back a submission recorded by rateLimitScript
+// KEYS[1] GCRA key, KEYS[2] quota key, ARGV[1] now in ms, ARGV[2] emission interval in ms
+// (0 if the rate was not recorded), ARGV[3] 1 if the quota was counted
+var refundScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+
+if interval > 0 then
+	local tat = tonumber(redis.call('GET', KEYS[1]))
+	if tat then
+		tat = tat - interval
+		if tat > now then
+			redis.call('SET', KEYS[1], tat, 'PX', tat - now)
+		else
+			redis.call('DEL', KEYS[1])
+		end
+	end
+end
+
+if ARGV[3] == '1' and (tonumber(redis.call('GET', KEYS[2])) or 0) > 0 then
+	redis.call('DECR', KEYS[2])
+end
+return 0
+`)
+
+type RateLimiterServiceInterface interface {
+	Allow(ctx context.Context, tenantID string, reportType string) (*RateLimitReservation, error)
+}
+
+// RateLimiterService limits report submissions in Redis, shared by every instance
+// The rate applies per tenant and report type, the daily quota per tenant
+type RateLimiterService struct {
+	cfg *config.Config
+	rdb *redis.Client
+}
+
+func NewRateLimiterService(cfg *config.Config, rdb *redis.Client) RateLimiterServiceInterface {
+	return &RateLimiterService{
+		cfg: cfg,
+		rdb: rdb,
+	}
+}
+
+// Allow records a submission, or returns a *RateLimitError if it exceeds a limit
+// The returned reservation takes the submission back if it fails afterwards
+func (s *RateLimiterService) Allow(ctx context.Context, tenantID string, reportType string) (*RateLimitReservation, error) {
+	return s.allow(ctx, tenantID, reportType, time.Now().UTC())
+}
+
+// allow is Allow at the given time
+func (s *RateLimiterService) allow(ctx context.Context, tenantID string, reportType string, now time.Time) (*RateLimitReservation, error) {
+	limits := s.cfg.RateLimit
+	if limits.Rate == 0 && limits.DailyQuota == 0 {
+		return &RateLimitReservation{}, nil
+	}
+
+	var interval time.Duration
+	if limits.Rate > 0 {
+		interval = limits.Period / time.Duration(limits.Rate)
+	}
+	day := now.Truncate(24 * time.Hour)
+	untilReset := day.Add(24 * time.Hour).Sub(now)
+
+	keys := []string{
+		config.KEY_PREFIX_RATE_LIMIT + tenantID + ":" + reportType,
+		config.KEY_PREFIX_QUOTA + tenantID + ":" + day.Format("20060102"),
+	}
+	reply, err := rateLimitScript.Run(ctx, s.rdb, keys,
+		now.UnixMilli(), interval.Milliseconds(), limits.Burst, limits.DailyQuota, untilReset.Milliseconds()).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rate limit of tenant %s: %w", tenantID, err)
+	}
+
+	if limited, _ := reply[0].(int64); limited == 0 {
+		return &RateLimitReservation{
+			rdb:      s.rdb,
+			tenantID: tenantID,
+			keys:     keys,
+			interval: interval,
+			quota:    limits.DailyQuota > 0,
+		}, nil
+	}
+	limit, _ := reply[1].(string)
+	retryAfter, _ := reply[2].(int64)
+	return nil, &RateLimitError{
+		TenantID:   tenantID,
+		ReportType: reportType,
+		Limit:      limit,
+		RetryAfter: time.Duration(retryAfter) * time.Millisecond,
+	}
+}
+
+// RateLimitReservation is a submission recorded by Allow
+type RateLimitReservation struct {
+	rdb      *redis.Client // Nil if no limit applied
+	tenantID string
+	keys     []string
+	interval time.Duration // Emission interval the rate was recorded with, 0 if it was not
+	quota    bool          // Whether the submission was counted against the daily quota
+}
+
+// Cancel takes the submission back, so it counts against neither the rate nor the quota
+func (r *RateLimitReservation) Cancel(ctx context.Context) error {
+	return r.cancel(ctx, time.Now().UTC())
+}
+
+// cancel is Cancel at the given time
+func (r *RateLimitReservation) cancel(ctx context.Context, now time.Time) error {
+	if r.rdb == nil {
+		return nil
+	}
+	quota := 0
+	if r.quota {
+		quota = 1
+	}
+	if err := refundScript.Run(ctx, r.rdb, r.keys, now.UnixMilli(), r.interval.Milliseconds(), quota).Err(); err != nil {
+		return fmt.Errorf("failed to refund rate limit of tenant %s: %w", r.tenantID, err)
+	}
+	return nil
+}
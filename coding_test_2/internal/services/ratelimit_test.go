@@ -0,0 +1,150 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+var rateLimitNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestRateLimiter(t *testing.T, limits config.RateLimitConfig) *RateLimiterService {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return &RateLimiterService{cfg: &config.Config{RateLimit: limits}, rdb: rdb}
+}
+
+// allowAt calls allow and returns the reservation, failing the test on unexpected errors
+func allowAt(t *testing.T, s *RateLimiterService, reportType string, now time.Time) (*RateLimitReservation, *RateLimitError) {
+	t.Helper()
+	reservation, err := s.allow(context.Background(), "tenant", reportType, now)
+	var limitErr *RateLimitError
+	if errors.As(err, &limitErr) {
+		return nil, limitErr
+	}
+	if err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	return reservation, nil
+}
+
+func TestRateLimitBurstThenEmissionInterval(t *testing.T) {
+	s := newTestRateLimiter(t, config.RateLimitConfig{Rate: 60, Period: time.Minute, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		if _, limitErr := allowAt(t, s, "sales", rateLimitNow); limitErr != nil {
+			t.Fatalf("submission %d of the burst limited: %v", i+1, limitErr)
+		}
+	}
+	_, limitErr := allowAt(t, s, "sales", rateLimitNow)
+	if limitErr == nil || limitErr.Limit != "rate" || limitErr.RetryAfter != time.Second {
+		t.Fatalf("got %v, want rate limited for 1s", limitErr)
+	}
+
+	// The rate applies per report type
+	if _, limitErr := allowAt(t, s, "inventory", rateLimitNow); limitErr != nil {
+		t.Fatalf("other report type limited: %v", limitErr)
+	}
+
+	// One submission per emission interval is accepted once the burst is used up
+	if _, limitErr := allowAt(t, s, "sales", rateLimitNow.Add(999*time.Millisecond)); limitErr == nil || limitErr.RetryAfter != time.Millisecond {
+		t.Fatalf("got %v, want rate limited for 1ms", limitErr)
+	}
+	if _, limitErr := allowAt(t, s, "sales", rateLimitNow.Add(time.Second)); limitErr != nil {
+		t.Fatalf("submission after the emission interval limited: %v", limitErr)
+	}
+	if _, limitErr := allowAt(t, s, "sales", rateLimitNow.Add(time.Second)); limitErr == nil {
+		t.Fatal("second submission within the emission interval accepted")
+	}
+
+	// An idle period refills the burst, but not beyond it
+	later := rateLimitNow.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, limitErr := allowAt(t, s, "sales", later); limitErr != nil {
+			t.Fatalf("submission %d of the refilled burst limited: %v", i+1, limitErr)
+		}
+	}
+	if _, limitErr := allowAt(t, s, "sales", later); limitErr == nil {
+		t.Fatal("submission beyond the refilled burst accepted")
+	}
+}
+
+func TestRateLimitDailyQuota(t *testing.T) {
+	s := newTestRateLimiter(t, config.RateLimitConfig{DailyQuota: 2})
+
+	// The quota is shared by every report type of the tenant
+	for _, reportType := range []string{"sales", "inventory"} {
+		if _, limitErr := allowAt(t, s, reportType, rateLimitNow); limitErr != nil {
+			t.Fatalf("%s submission limited: %v", reportType, limitErr)
+		}
+	}
+	_, limitErr := allowAt(t, s, "financial", rateLimitNow)
+	if limitErr == nil || limitErr.Limit != "daily_quota" || limitErr.RetryAfter != 12*time.Hour {
+		t.Fatalf("got %v, want daily quota exceeded until midnight", limitErr)
+	}
+
+	// The next day has a quota of its own
+	if _, limitErr := allowAt(t, s, "sales", rateLimitNow.Add(12*time.Hour)); limitErr != nil {
+		t.Fatalf("submission of the next day limited: %v", limitErr)
+	}
+}
+
+func TestRateLimitRejectionsAreNotRecorded(t *testing.T) {
+	s := newTestRateLimiter(t, config.RateLimitConfig{Rate: 60, Period: time.Minute, Burst: 1, DailyQuota: 2})
+
+	if _, limitErr := allowAt(t, s, "sales", rateLimitNow); limitErr != nil {
+		t.Fatalf("first submission limited: %v", limitErr)
+	}
+	for i := 0; i < 5; i++ {
+		if _, limitErr := allowAt(t, s, "sales", rateLimitNow); limitErr == nil || limitErr.Limit != "rate" {
+			t.Fatalf("got %v, want rate limited", limitErr)
+		}
+	}
+
+	// Neither the rate nor the quota counted the rejected submissions
+	if _, limitErr := allowAt(t, s, "sales", rateLimitNow.Add(time.Second)); limitErr != nil {
+		t.Fatalf("submission after the emission interval limited: %v", limitErr)
+	}
+	if _, limitErr := allowAt(t, s, "sales", rateLimitNow.Add(time.Minute)); limitErr == nil || limitErr.Limit != "daily_quota" {
+		t.Fatalf("got %v, want daily quota exceeded", limitErr)
+	}
+}
+
+func TestRateLimitReservationCancel(t *testing.T) {
+	s := newTestRateLimiter(t, config.RateLimitConfig{Rate: 60, Period: time.Minute, Burst: 1, DailyQuota: 1})
+
+	for i := 0; i < 3; i++ {
+		reservation, limitErr := allowAt(t, s, "sales", rateLimitNow)
+		if limitErr != nil {
+			t.Fatalf("submission %d limited after cancelling the previous one: %v", i+1, limitErr)
+		}
+		if err := reservation.cancel(context.Background(), rateLimitNow); err != nil {
+			t.Fatalf("cancel: %v", err)
+		}
+	}
+
+	if _, limitErr := allowAt(t, s, "sales", rateLimitNow); limitErr != nil {
+		t.Fatalf("submission limited: %v", limitErr)
+	}
+	if _, limitErr := allowAt(t, s, "sales", rateLimitNow.Add(time.Second)); limitErr == nil || limitErr.Limit != "daily_quota" {
+		t.Fatalf("got %v, want daily quota exceeded", limitErr)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	s := &RateLimiterService{cfg: &config.Config{}} // No Redis, it must not be used
+
+	reservation, err := s.allow(context.Background(), "tenant", "sales", rateLimitNow)
+	if err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	if err := reservation.Cancel(context.Background()); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// reapBatchSize bounds the expired leases recovered per reap
+const reapBatchSize = 100
+
+// forgetLeaseScript removes a report from KEY_LEASES unless its lease was renewed meanwhile
+// KEYS[1] leases set, ARGV[1] report key, ARGV[2] now (unix ms)
+var forgetLeaseScript = redis.NewScript(`
+local expiry = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if expiry and tonumber(expiry) <= tonumber(ARGV[2]) then
+	return redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// awaitRedelivery indexes a RETRYING report in KEY_LEASES so the reaper fails it if RabbitMQ
+// does not redeliver it within timeout; a lease taken by a redelivery already is kept
+func awaitRedelivery(ctx context.Context, rdb *redis.Client, tenantID string, requestID string, timeout time.Duration) error {
+	expiry := time.Now().Add(timeout).UnixMilli()
+	member := models.ReportKey(tenantID, requestID)
+	if err := rdb.ZAddNX(ctx, config.KEY_LEASES, &redis.Z{Score: float64(expiry), Member: member}).Err(); err != nil {
+		return fmt.Errorf("failed to track redelivery of %s: %w", requestID, err)
+	}
+	return nil
+}
+
+type ReaperServiceInterface interface {
+	Run(ctx context.Context) error
+}
+
+// ReaperService recovers reports whose worker stopped renewing its lease, e.g. because its
+// process died, which would otherwise stay IN_PROGRESS until their status expires
+// Every instance runs it, the status state machine keeps a report from being recovered twice
+type ReaperService struct {
+	cfg    *config.Config
+	rdb    *redis.Client
+	worker string // Name of the reaper in status histories
+}
+
+func NewReaperService(cfg *config.Config, rdb *redis.Client) ReaperServiceInterface {
+	return &ReaperService{
+		cfg:    cfg,
+		rdb:    rdb,
+		worker: instanceName() + "/reaper",
+	}
+}
+
+// Run recovers reports with expired leases every reap interval until ctx is cancelled
+func (s *ReaperService) Run(ctx context.Context) error {
+	log.Println("[Reaper] Started")
+	defer log.Println("[Reaper] Stopped")
+
+	ticker := time.NewTicker(s.cfg.Recovery.ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		if err := s.reap(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[Reaper] Failed to look for expired leases: %v", err)
+		}
+	}
+}
+
+// reap recovers the reports whose lease has expired
+func (s *ReaperService) reap(ctx context.Context) error {
+	now := time.Now()
+	reports, err := s.rdb.ZRangeByScore(ctx, config.KEY_LEASES, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: reapBatchSize,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		tenantID, requestID, ok := models.ParseReportKey(report)
+		if !ok {
+			// Not a report key, e.g. left by an older version, it cannot be recovered
+			log.Printf("[Reaper] Dropping malformed lease %q", report)
+			if err := s.forgetLease(ctx, report, now); err != nil {
+				log.Printf("[Reaper] %v", err)
+			}
+			continue
+		}
+		if err := s.recover(ctx, tenantID, requestID, now); err != nil {
+			log.Printf("[Reaper] %v", err)
+		}
+	}
+	return nil
+}
+
+// recover retries a report left IN_PROGRESS, or fails it once it used up its attempts
+// RETRYING reports come back here if RabbitMQ did not redeliver them in time and are failed
+// The broker requeues the delivery of a dead consumer by itself, the redelivery resumes the
+// RETRYING report; a redelivery that finds it FAILED is rejected by the worker
+func (s *ReaperService) recover(ctx context.Context, tenantID string, requestID string, now time.Time) error {
+	// A live claim belongs to a worker that renews it, e.g. one processing a redelivery
+	report := models.ReportKey(tenantID, requestID)
+	held, err := s.rdb.Exists(ctx, config.KEY_PREFIX_REPORT_CLAIM+report).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check claim on %s: %w", requestID, err)
+	}
+	if held > 0 {
+		return nil
+	}
+
+	status, err := readStatus(ctx, s.rdb, config.KEY_PREFIX_REPORT_STATUS+report)
+	if err != nil {
+		return fmt.Errorf("failed to get status of %s: %w", requestID, err)
+	}
+
+	retrying := false
+	switch status {
+	case models.StatusInProgress:
+		attempt, err := lastAttempt(ctx, s.rdb, tenantID, requestID)
+		if err != nil {
+			return err
+		}
+		if attempt >= s.cfg.Recovery.MaxAttempts {
+			log.Printf("[Reaper] Lease of %s expired on its last attempt (%d), marking it FAILED", requestID, attempt)
+			_, err = updateReportStatus(ctx, s.rdb, s.worker, tenantID, requestID, models.StatusFailed, nil,
+				fmt.Sprintf("worker lease expired on attempt %d of %d", attempt, s.cfg.Recovery.MaxAttempts))
+		} else {
+			log.Printf("[Reaper] Lease of %s expired on attempt %d, marking it for retry", requestID, attempt)
+			_, err = updateReportStatus(ctx, s.rdb, s.worker, tenantID, requestID, models.StatusRetrying, nil, "worker lease expired")
+			retrying = err == nil
+		}
+		if err != nil && !errors.Is(err, models.ErrInvalidTransition) {
+			return err
+		}
+	case models.StatusRetrying:
+		log.Printf("[Reaper] %s was not redelivered within %s, marking it FAILED", requestID, s.cfg.Recovery.RedeliveryTimeout)
+		_, err = updateReportStatus(ctx, s.rdb, s.worker, tenantID, requestID, models.StatusFailed, nil,
+			fmt.Sprintf("not redelivered within %s", s.cfg.Recovery.RedeliveryTimeout))
+		if err != nil && !errors.Is(err, models.ErrInvalidTransition) {
+			return err
+		}
+	}
+
+	// Other statuses need no recovery; a rejected transition means someone else moved the report on
+	if err := s.forgetLease(ctx, report, now); err != nil {
+		return err
+	}
+	if retrying {
+		return awaitRedelivery(ctx, s.rdb, tenantID, requestID, s.cfg.Recovery.RedeliveryTimeout)
+	}
+	return nil
+}
+
+// forgetLease removes the lease of a report from KEY_LEASES unless it was renewed after now
+func (s *ReaperService) forgetLease(ctx context.Context, report string, now time.Time) error {
+	if err := forgetLeaseScript.Run(ctx, s.rdb, []string{config.KEY_LEASES}, report, now.UnixMilli()).Err(); err != nil {
+		return fmt.Errorf("failed to forget lease of %s: %w", report, err)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/generators"
+	"coding_test_2/internal/models"
+	"coding_test_2/internal/storage"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrReportNotFound is returned when no status is stored for a report
+	ErrReportNotFound = errors.New("report not found")
+	// ErrArtifactNotAvailable is returned when a report has no stored artifact (yet)
+	ErrArtifactNotAvailable = errors.New("report artifact not available")
+	// ErrInvalidSignature is returned for expired or tampered download URLs
+	ErrInvalidSignature = errors.New("invalid or expired download signature")
+	// ErrInvalidPriority is returned for submissions with a priority outside the configured range
+	ErrInvalidPriority = errors.New("invalid report priority")
+	// ErrInvalidTenant is returned for tenant IDs that cannot be part of a report key
+	ErrInvalidTenant = errors.New("invalid tenant ID")
+)
+
+type ReportServiceInterface interface {
+	SubmitReport(ctx context.Context, request models.ReportRequest) (*models.ReportRequest, error)
+	GetReport(ctx context.Context, tenantID string, requestID string) (*models.ReportResult, error)
+	GetReportHistory(ctx context.Context, tenantID string, requestID string) (*models.ReportHistory, error)
+	CancelReport(ctx context.Context, tenantID string, requestID string) (*models.ReportResult, error)
+	OpenArtifact(ctx context.Context, tenantID string, requestID string) (*models.ArtifactMetadata, io.ReadCloser, error)
+	DownloadURL(ctx context.Context, tenantID string, requestID string) (string, time.Time, error)
+	VerifyDownload(tenantID string, requestID string, expires string, signature string) error
+}
+
+type ReportService struct {
+	cfg        *config.Config
+	rdb        *redis.Client
+	store      storage.ReportStore
+	generators *generators.Registry
+	outbox     OutboxServiceInterface
+	limiter    RateLimiterServiceInterface
+}
+
+func NewReportService(cfg *config.Config, rdb *redis.Client, store storage.ReportStore, generators *generators.Registry, outbox OutboxServiceInterface, limiter RateLimiterServiceInterface) ReportServiceInterface {
+	return &ReportService{
+		cfg:        cfg,
+		rdb:        rdb,
+		store:      store,
+		generators: generators,
+		outbox:     outbox,
+		limiter:    limiter,
+	}
+}
+
+// SubmitReport validates a report request and queues it through the outbox
+// An ID is assigned when the request has none and a priority when it has none, the
+// type's default; validation errors are permanent
+// Submissions over the tenant's rate limit or daily quota fail with a *RateLimitError,
+// failed submissions do not count against them
+func (s *ReportService) SubmitReport(ctx context.Context, request models.ReportRequest) (*models.ReportRequest, error) {
+	if err := s.generators.Validate(request); err != nil {
+		return nil, err
+	}
+	if err := validatePriority(s.cfg, request.Priority); err != nil {
+		return nil, err
+	}
+	if err := validateTenant(request.TenantID); err != nil {
+		return nil, err
+	}
+	if request.CallbackURL != "" {
+		if err := validateCallbackURL(request.CallbackURL, s.cfg.Webhook.AllowPrivateHosts); err != nil {
+			return nil, err
+		}
+	}
+	if request.Priority == 0 {
+		request.Priority = s.cfg.Priority.ForType(request.ReportType)
+	}
+
+	if request.ID == "" {
+		request.ID = uuid.NewString()
+	}
+	request.TenantID = request.Tenant()
+	request.CreatedAt = time.Now().UTC()
+
+	reservation, err := s.limiter.Allow(ctx, request.TenantID, request.ReportType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.outbox.Submit(ctx, request); err != nil {
+		// Only accepted submissions count against the tenant's limits
+		if err := reservation.Cancel(context.WithoutCancel(ctx)); err != nil {
+			log.Printf("[RateLimit] %v", err)
+		}
+		return nil, err
+	}
+	return &request, nil
+}
+
+// validatePriority checks a requested priority against the configured range, 0 selects the type's default
+func validatePriority(cfg *config.Config, priority int) error {
+	if priority < 0 || priority > cfg.Priority.Max {
+		return fmt.Errorf("%w: must be between 1 and %d, got %d", ErrInvalidPriority, cfg.Priority.Max, priority)
+	}
+	return nil
+}
+
+// validateTenant rejects tenant IDs containing the separator of report keys, see models.ReportKey
+func validateTenant(tenantID string) error {
+	if strings.Contains(tenantID, ":") {
+		return fmt.Errorf("%w: must not contain ':', got %q", ErrInvalidTenant, tenantID)
+	}
+	return nil
+}
+
+// GetReport returns the latest status of a report of the tenant from Redis
+// Reports of other tenants are not found, request IDs are only unique within a tenant
+func (s *ReportService) GetReport(ctx context.Context, tenantID string, requestID string) (*models.ReportResult, error) {
+	resultJson, err := s.rdb.Get(ctx, config.KEY_PREFIX_REPORT_STATUS+models.ReportKey(tenantID, requestID)).Result()
+	if err == redis.Nil {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status for %s: %w", requestID, err)
+	}
+
+	var result models.ReportResult
+	if err := json.Unmarshal([]byte(resultJson), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse status for %s: %w", requestID, err)
+	}
+	return &result, nil
+}
+
+// GetReportHistory returns every status transition of a report and the time spent in each status
+func (s *ReportService) GetReportHistory(ctx context.Context, tenantID string, requestID string) (*models.ReportHistory, error) {
+	transitions, err := readHistory(ctx, s.rdb, tenantID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if len(transitions) == 0 {
+		return nil, ErrReportNotFound
+	}
+	return models.NewReportHistory(requestID, transitions, time.Now().UTC()), nil
+}
+
+// CancelReport marks a queued or running report CANCELLED and tells the consumers to abort it
+// Reports that already reached a final status fail with a *models.TransitionError
+func (s *ReportService) CancelReport(ctx context.Context, tenantID string, requestID string) (*models.ReportResult, error) {
+	result, err := updateReportStatus(ctx, s.rdb, "api", tenantID, requestID, models.StatusCancelled, nil, ErrReportCancelled.Error())
+	var transitionErr *models.TransitionError
+	if errors.As(err, &transitionErr) && transitionErr.From == "" {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Queued deliveries are dropped when the distributor sees the status,
+	// a running task has to be aborted by the consumer running it
+	controlJson, err := json.Marshal(models.ControlMessage{Action: models.ControlCancel, TenantID: tenantID, RequestID: requestID})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rdb.Publish(ctx, config.CHANNEL_REPORT_CONTROL, string(controlJson)).Err(); err != nil {
+		return nil, fmt.Errorf("failed to publish cancellation of %s: %w", requestID, err)
+	}
+	return result, nil
+}
+
+// OpenArtifact opens the stored artifact of a completed report, the caller must close it
+func (s *ReportService) OpenArtifact(ctx context.Context, tenantID string, requestID string) (*models.ArtifactMetadata, io.ReadCloser, error) {
+	metadata, err := s.artifact(ctx, tenantID, requestID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := s.store.Get(ctx, metadata.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrArtifactNotAvailable
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return metadata, content, nil
+}
+
+// DownloadURL returns a time-limited URL for the report artifact
+// Stores supporting signed URLs are linked directly, others through the API download endpoint
+func (s *ReportService) DownloadURL(ctx context.Context, tenantID string, requestID string) (string, time.Time, error) {
+	metadata, err := s.artifact(ctx, tenantID, requestID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(s.cfg.HTTP.DownloadURLExpiry).UTC()
+
+	signedURL, err := s.store.SignedURL(ctx, metadata.Key, s.cfg.HTTP.DownloadURLExpiry)
+	if err == nil {
+		return signedURL, expiresAt, nil
+	}
+	if !errors.Is(err, storage.ErrSignedURLUnsupported) {
+		return "", time.Time{}, err
+	}
+
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query := url.Values{
+		"tenant":    {tenantID},
+		"expires":   {expires},
+		"signature": {s.signDownload(tenantID, requestID, expires)},
+	}
+	downloadURL := fmt.Sprintf("%s/reports/%s/download?%s", s.cfg.HTTP.PublicBaseURL, url.PathEscape(requestID), query.Encode())
+	return downloadURL, expiresAt, nil
+}
+
+// VerifyDownload checks the expiry and signature of an API download URL
+// The signature covers the tenant, a URL cannot be altered to download another tenant's report
+func (s *ReportService) VerifyDownload(tenantID string, requestID string, expires string, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(s.signDownload(tenantID, requestID, expires)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// artifact returns the artifact metadata of a completed report
+func (s *ReportService) artifact(ctx context.Context, tenantID string, requestID string) (*models.ArtifactMetadata, error) {
+	result, err := s.GetReport(ctx, tenantID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if result.Status != models.StatusCompleted || result.Artifact == nil {
+		return nil, ErrArtifactNotAvailable
+	}
+	return result.Artifact, nil
+}
+
+// signDownload returns the hex encoded HMAC-SHA256 of the tenant, report ID and expiry
+func (s *ReportService) signDownload(tenantID string, requestID string, expires string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.HTTP.DownloadSigningKey))
+	mac.Write([]byte(tenantID + "\n" + requestID + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/models"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestReportsAreScopedByTenant(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	cfg := &config.Config{}
+	outbox := &OutboxService{cfg: cfg, rdb: rdb, consumer: "relay-1"}
+	reports := &ReportService{cfg: cfg, rdb: rdb, outbox: outbox}
+
+	// Request IDs are only unique within a tenant
+	for _, tenantID := range []string{"merchant-1", "merchant-2"} {
+		if err := outbox.Submit(ctx, models.ReportRequest{ID: "report-1", TenantID: tenantID, ReportType: "sales"}); err != nil {
+			t.Fatalf("submit for %s: %v", tenantID, err)
+		}
+	}
+	if _, err := reports.CancelReport(ctx, "merchant-2", "report-1"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	result, err := reports.GetReport(ctx, "merchant-1", "report-1")
+	if err != nil || result.Status != models.StatusPending || result.TenantID != "merchant-1" {
+		t.Fatalf("got %+v (%v), want merchant-1's report still PENDING", result, err)
+	}
+	history, err := reports.GetReportHistory(ctx, "merchant-1", "report-1")
+	if err != nil || len(history.Transitions) != 1 {
+		t.Fatalf("got %+v (%v), want only merchant-1's submission", history, err)
+	}
+
+	// Another tenant can neither read nor cancel the report
+	if _, err := reports.GetReport(ctx, "merchant-3", "report-1"); !errors.Is(err, ErrReportNotFound) {
+		t.Fatalf("got %v, want ErrReportNotFound", err)
+	}
+	if _, err := reports.GetReportHistory(ctx, "merchant-3", "report-1"); !errors.Is(err, ErrReportNotFound) {
+		t.Fatalf("got %v, want ErrReportNotFound", err)
+	}
+	if _, err := reports.CancelReport(ctx, "merchant-3", "report-1"); !errors.Is(err, ErrReportNotFound) {
+		t.Fatalf("got %v, want ErrReportNotFound", err)
+	}
+}
+
+func TestValidateTenant(t *testing.T) {
+	if err := validateTenant("merchant-1"); err != nil {
+		t.Fatalf("got %v, want merchant-1 accepted", err)
+	}
+	if err := validateTenant("merchant:1"); !errors.Is(err, ErrInvalidTenant) {
+		t.Fatalf("got %v, want ErrInvalidTenant", err)
+	}
+}
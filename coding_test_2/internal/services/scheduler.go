@@ -0,0 +1,338 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/generators"
+	"coding_test_2/internal/messages"
+	"coding_test_2/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	// ErrScheduleNotFound is returned when no schedule is stored under an ID
+	ErrScheduleNotFound = errors.New("schedule not found")
+	// ErrScheduleExists is returned when creating a schedule whose ID is already in use
+	ErrScheduleExists = errors.New("schedule already exists")
+	// ErrInvalidSchedule is returned for schedules with an unparsable cron expression, an invalid
+	// priority or callback URL
+	ErrInvalidSchedule = errors.New("invalid schedule")
+)
+
+// leadScript takes or renews the scheduler leadership
+// KEYS[1] leader key, ARGV[1] instance, ARGV[2] lease in ms
+var leadScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// saveRunScript stores a schedule after a run unless it was deleted in the meantime
+// KEYS[1] schedules hash, KEYS[2] due set, ARGV[1] ID, ARGV[2] schedule JSON, ARGV[3] next run (unix)
+var saveRunScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+return 1
+`)
+
+type SchedulerServiceInterface interface {
+	CreateSchedule(ctx context.Context, schedule models.Schedule) (*models.Schedule, error)
+	GetSchedule(ctx context.Context, scheduleID string) (*models.Schedule, error)
+	ListSchedules(ctx context.Context) ([]models.Schedule, error)
+	DeleteSchedule(ctx context.Context, scheduleID string) error
+	Run(ctx context.Context) error
+}
+
+// SchedulerService stores cron schedules in Redis and submits their reports when due
+// Every instance may run it, a leader elected through Redis is the only one firing schedules
+type SchedulerService struct {
+	cfg        *config.Config
+	rdb        *redis.Client
+	generators *generators.Registry
+	reports    ReportServiceInterface
+	instance   string // Name of this instance in the leader election
+}
+
+func NewSchedulerService(cfg *config.Config, rdb *redis.Client, generators *generators.Registry, reports ReportServiceInterface) SchedulerServiceInterface {
+	return &SchedulerService{
+		cfg:        cfg,
+		rdb:        rdb,
+		generators: generators,
+		reports:    reports,
+		instance:   instanceName(),
+	}
+}
+
+// CreateSchedule validates and stores a schedule, an ID is assigned when it has none
+func (s *SchedulerService) CreateSchedule(ctx context.Context, schedule models.Schedule) (*models.Schedule, error) {
+	cronSchedule, err := cron.ParseStandard(schedule.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+
+	if schedule.Range != "" {
+		if !schedule.Range.Valid() {
+			return nil, fmt.Errorf("%w: unknown range %q, must be one of %s, %s, %s or %s", ErrInvalidSchedule, schedule.Range,
+				models.RangePreviousDay, models.RangePreviousWeek, models.RangePreviousMonth, models.RangeMonthToDate)
+		}
+		if _, ok := schedule.Parameters["start_date"]; ok {
+			return nil, fmt.Errorf("%w: range and start_date are exclusive", ErrInvalidSchedule)
+		}
+		if _, ok := schedule.Parameters["end_date"]; ok {
+			return nil, fmt.Errorf("%w: range and end_date are exclusive", ErrInvalidSchedule)
+		}
+	}
+
+	now := time.Now().UTC()
+	if err := s.generators.Validate(schedule.Request(now)); err != nil {
+		return nil, err
+	}
+	// Runs are submitted like API requests, reject what every run would fail with
+	if err := validatePriority(s.cfg, schedule.Priority); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if err := validateTenant(schedule.TenantID); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if schedule.CallbackURL != "" {
+		if err := validateCallbackURL(schedule.CallbackURL, s.cfg.Webhook.AllowPrivateHosts); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+	}
+
+	if schedule.ID == "" {
+		schedule.ID = uuid.NewString()
+	}
+	schedule.CreatedAt = now
+	schedule.LastRunAt = nil
+	schedule.LastRequestID = ""
+	schedule.LastError = ""
+	schedule.NextRunAt = cronSchedule.Next(now).UTC()
+
+	scheduleJson, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schedule %s: %w", schedule.ID, err)
+	}
+
+	err = s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.HExists(ctx, config.KEY_SCHEDULES, schedule.ID).Result()
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrScheduleExists
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, config.KEY_SCHEDULES, schedule.ID, string(scheduleJson))
+			pipe.ZAdd(ctx, config.KEY_SCHEDULES_DUE, &redis.Z{Score: float64(schedule.NextRunAt.Unix()), Member: schedule.ID})
+			return nil
+		})
+		return err
+	}, config.KEY_SCHEDULES)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Scheduler] Created schedule %s (%s), next run at %s", schedule.ID, schedule.Cron, schedule.NextRunAt.Format(time.RFC3339))
+	return &schedule, nil
+}
+
+// GetSchedule returns a schedule along with its last and next run
+func (s *SchedulerService) GetSchedule(ctx context.Context, scheduleID string) (*models.Schedule, error) {
+	scheduleJson, err := s.rdb.HGet(ctx, config.KEY_SCHEDULES, scheduleID).Result()
+	if err == redis.Nil {
+		return nil, ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedule %s: %w", scheduleID, err)
+	}
+
+	var schedule models.Schedule
+	if err := json.Unmarshal([]byte(scheduleJson), &schedule); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule %s: %w", scheduleID, err)
+	}
+	return &schedule, nil
+}
+
+// ListSchedules returns every schedule ordered by next run
+func (s *SchedulerService) ListSchedules(ctx context.Context) ([]models.Schedule, error) {
+	ids, err := s.rdb.ZRange(ctx, config.KEY_SCHEDULES_DUE, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	schedules := make([]models.Schedule, 0, len(ids))
+	for _, id := range ids {
+		schedule, err := s.GetSchedule(ctx, id)
+		if errors.Is(err, ErrScheduleNotFound) {
+			continue // Deleted meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *schedule)
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule removes a schedule, reports it already submitted are not affected
+func (s *SchedulerService) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	var deleted *redis.IntCmd
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.HDel(ctx, config.KEY_SCHEDULES, scheduleID)
+		pipe.ZRem(ctx, config.KEY_SCHEDULES_DUE, scheduleID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule %s: %w", scheduleID, err)
+	}
+	if deleted.Val() == 0 {
+		return ErrScheduleNotFound
+	}
+
+	log.Printf("[Scheduler] Deleted schedule %s", scheduleID)
+	return nil
+}
+
+// Run competes for the scheduler leadership and, while leading, submits the reports of
+// due schedules until ctx is cancelled
+// Missed runs (e.g. while no instance was leading) are fired once, not caught up one by one
+func (s *SchedulerService) Run(ctx context.Context) error {
+	log.Println("[Scheduler] Started")
+	defer log.Println("[Scheduler] Stopped")
+
+	ticker := time.NewTicker(s.cfg.Scheduler.PollInterval)
+	defer ticker.Stop()
+
+	leading := false
+	for {
+		select {
+		case <-ctx.Done():
+			if leading {
+				// Let another instance take over without waiting for the lease to expire
+				releaseScript.Run(context.Background(), s.rdb, []string{config.KEY_SCHEDULER_LEADER}, s.instance)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		lead, err := leadScript.Run(ctx, s.rdb, []string{config.KEY_SCHEDULER_LEADER}, s.instance, s.cfg.Scheduler.LeaderLease.Milliseconds()).Int()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[Scheduler] Failed to renew leadership: %v", err)
+			}
+			leading = false
+			continue
+		}
+		if (lead == 1) != leading {
+			leading = lead == 1
+			if leading {
+				log.Printf("[Scheduler] %s is now the leader", s.instance)
+			} else {
+				log.Printf("[Scheduler] %s lost the leadership", s.instance)
+			}
+		}
+		if !leading {
+			continue
+		}
+
+		if err := s.fireDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[Scheduler] Failed to fire due schedules: %v", err)
+		}
+	}
+}
+
+// fireDue submits the report of every schedule whose next run has come
+func (s *SchedulerService) fireDue(ctx context.Context) error {
+	now := time.Now().UTC()
+	ids, err := s.rdb.ZRangeByScore(ctx, config.KEY_SCHEDULES_DUE, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		schedule, err := s.GetSchedule(ctx, id)
+		if errors.Is(err, ErrScheduleNotFound) {
+			s.rdb.ZRem(ctx, config.KEY_SCHEDULES_DUE, id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.fire(ctx, schedule, now)
+	}
+	return nil
+}
+
+// fire submits the report of a due schedule and records the run
+func (s *SchedulerService) fire(ctx context.Context, schedule *models.Schedule, now time.Time) {
+	cronSchedule, err := cron.ParseStandard(schedule.Cron)
+	if err != nil {
+		// Stored schedules were parsed on creation, this should not happen
+		log.Printf("[Scheduler] Dropping schedule %s with invalid cron expression: %v", schedule.ID, err)
+		s.rdb.ZRem(ctx, config.KEY_SCHEDULES_DUE, schedule.ID)
+		return
+	}
+
+	// The request ID is derived from the run time, a run submitted already by a
+	// previous leader is not submitted twice
+	request := schedule.Request(schedule.NextRunAt)
+	_, err = s.reports.SubmitReport(messages.WithCorrelationID(ctx, schedule.ID), request)
+	if errors.Is(err, ErrReportExists) {
+		err = nil
+	}
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		// Postpone the run until the tenant's limit allows it, it keeps its run time and request ID
+		log.Printf("[Scheduler] Run of schedule %s postponed by %s: %v", schedule.ID, rateLimitErr.RetryAfter, err)
+		retryAt := now.Add(rateLimitErr.RetryAfter)
+		s.rdb.ZAddXX(ctx, config.KEY_SCHEDULES_DUE, &redis.Z{Score: float64(retryAt.Unix()), Member: schedule.ID})
+		return
+	}
+	if err != nil && !generators.IsPermanent(err) && !errors.Is(err, ErrInvalidPriority) {
+		// The run stays due and is retried on the next tick
+		log.Printf("[Scheduler] Failed to submit run of schedule %s, will retry: %v", schedule.ID, err)
+		return
+	}
+
+	schedule.LastRunAt = &now
+	schedule.LastRequestID = request.ID
+	schedule.LastError = ""
+	if err != nil {
+		schedule.LastError = err.Error()
+		log.Printf("[Scheduler] Rejected run of schedule %s: %v", schedule.ID, err)
+	} else {
+		log.Printf("[Scheduler] Submitted request %s for schedule %s", request.ID, schedule.ID)
+	}
+	schedule.NextRunAt = cronSchedule.Next(now).UTC()
+
+	scheduleJson, err := json.Marshal(schedule)
+	if err != nil {
+		log.Printf("[Scheduler] Failed to marshal schedule %s: %v", schedule.ID, err)
+		return
+	}
+	keys := []string{config.KEY_SCHEDULES, config.KEY_SCHEDULES_DUE}
+	if err := saveRunScript.Run(ctx, s.rdb, keys, schedule.ID, string(scheduleJson), schedule.NextRunAt.Unix()).Err(); err != nil {
+		log.Printf("[Scheduler] Failed to record run of schedule %s: %v", schedule.ID, err)
+	}
+}
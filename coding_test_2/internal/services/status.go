@@ -0,0 +1,128 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/models"
+	"coding_test_2/internal/tracing"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxStatusUpdateAttempts bounds the retries of a status update racing with another writer
+const maxStatusUpdateAttempts = 5
+
+// updateReportStatus updates the status of a report in Redis
+// The transition is checked against the current status atomically, an illegal one fails
+// with a *models.TransitionError and leaves the stored status untouched
+// Every transition is appended to the report's history along with the worker making it
+// Reports are keyed by tenant and request ID, see models.ReportKey
+// Only the artifact's metadata is kept in Redis, the content lives in the report store
+func updateReportStatus(ctx context.Context, rdb *redis.Client, worker string, tenantID string, requestID string, status models.ReportStatus, artifact *models.ArtifactMetadata, errMsg string) (*models.ReportResult, error) {
+	ctx, span := tracing.Start(ctx, "redis.update_status", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("report.id", requestID), attribute.String("report.status", string(status))))
+	result, err := writeReportStatus(ctx, rdb, worker, tenantID, requestID, status, artifact, errMsg)
+	tracing.End(span, err)
+	return result, err
+}
+
+// writeReportStatus does the work of updateReportStatus within its span
+func writeReportStatus(ctx context.Context, rdb *redis.Client, worker string, tenantID string, requestID string, status models.ReportStatus, artifact *models.ArtifactMetadata, errMsg string) (*models.ReportResult, error) {
+	result := models.ReportResult{
+		RequestID:   requestID,
+		TenantID:    tenantID,
+		Status:      status,
+		GeneratedAt: time.Now().UTC(),
+		Artifact:    artifact,
+		Error:       errMsg,
+	}
+
+	resultJson, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("[Redis] Failed to marshal result for %s: %s", requestID, err)
+		return nil, err
+	}
+
+	key := config.KEY_PREFIX_REPORT_STATUS + result.Key()
+	update := func(tx *redis.Tx) error {
+		from, err := readStatus(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if !models.CanTransition(from, status) {
+			return &models.TransitionError{RequestID: requestID, From: from, To: status}
+		}
+
+		attempt, err := lastAttempt(ctx, tx, tenantID, requestID)
+		if err != nil {
+			return err
+		}
+		if status == models.StatusInProgress {
+			attempt++
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, string(resultJson), 24*time.Hour) // TTL: 24 hours
+			if status.IsFinal() {
+				pipe.Set(ctx, config.KEY_PREFIX_REPORT_DATA+result.Key(), string(resultJson), 24*time.Hour) // TTL: 24 hours
+			}
+			return recordTransition(ctx, pipe, tenantID, models.StatusTransition{
+				RequestID: requestID,
+				From:      from,
+				To:        status,
+				At:        result.GeneratedAt,
+				Worker:    worker,
+				Attempt:   attempt,
+				Error:     errMsg,
+			})
+		})
+		return err
+	}
+
+	// Retry when the status or history changed between the read and the write
+	for attempt := 1; ; attempt++ {
+		err = rdb.Watch(ctx, update, key, config.KEY_PREFIX_REPORT_HISTORY+result.Key())
+		if err != redis.TxFailedErr || attempt >= maxStatusUpdateAttempts {
+			break
+		}
+	}
+	if err != nil {
+		// Rejected transitions are expected for duplicates, callers decide whether to report them
+		if !errors.Is(err, models.ErrInvalidTransition) {
+			log.Printf("[Redis] Failed to update status for %s: %s", requestID, status)
+		}
+		return nil, err
+	}
+
+	// Notify subscribers about the transition; a failed publish must not fail the update
+	if err := rdb.Publish(ctx, config.CHANNEL_REPORT_STATUS, string(resultJson)).Err(); err != nil {
+		log.Printf("[Redis] Failed to publish status for %s: %v", requestID, err)
+	}
+
+	log.Printf("[Redis] Updated status for %s: %s", requestID, status)
+	return &result, nil
+}
+
+// readStatus returns the status stored under key, or the empty status if there is none
+func readStatus(ctx context.Context, rdb redis.Cmdable, key string) (models.ReportStatus, error) {
+	resultJson, err := rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var result models.ReportResult
+	if err := json.Unmarshal([]byte(resultJson), &result); err != nil {
+		return "", fmt.Errorf("failed to parse status under %s: %w", key, err)
+	}
+	return result.Status, nil
+}
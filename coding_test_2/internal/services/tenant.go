@@ -0,0 +1,52 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// acquireSlotScript takes a concurrency slot of a tenant, expired slots are freed first
+// KEYS[1] running set, ARGV[1] request ID, ARGV[2] now in ms, ARGV[3] lease in ms, ARGV[4] limit
+var acquireSlotScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) or redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[4]) then
+	redis.call('ZADD', KEYS[1], tonumber(ARGV[2]) + tonumber(ARGV[3]), ARGV[1])
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// AcquireTenantSlot takes one of the tenant's concurrency slots for a report
+// It reports false while the tenant runs as many reports as its cap allows, across all instances
+// A slot not released (e.g. by a crashed consumer) is freed once its lease expires
+func (s *ConsumerService) AcquireTenantSlot(ctx context.Context, tenantID string, requestID string) (bool, error) {
+	limit := s.cfg.Tenants.ForTenant(tenantID).MaxConcurrent
+	if limit == 0 {
+		return true, nil
+	}
+
+	keys := []string{config.KEY_PREFIX_TENANT_RUNNING + tenantID}
+	now := time.Now().UnixMilli()
+	acquired, err := acquireSlotScript.Run(ctx, s.rdb, keys, requestID, now, s.cfg.Tenants.SlotLease.Milliseconds(), limit).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire slot of tenant %s for %s: %w", tenantID, requestID, err)
+	}
+	return acquired == 1, nil
+}
+
+// ReleaseTenantSlot gives back the slot taken for a report
+func (s *ConsumerService) ReleaseTenantSlot(ctx context.Context, tenantID string, requestID string) error {
+	if s.cfg.Tenants.ForTenant(tenantID).MaxConcurrent == 0 {
+		return nil
+	}
+
+	if err := s.rdb.ZRem(ctx, config.KEY_PREFIX_TENANT_RUNNING+tenantID, requestID).Err(); err != nil {
+		return fmt.Errorf("failed to release slot of tenant %s for %s: %w", tenantID, requestID, err)
+	}
+	return nil
+}
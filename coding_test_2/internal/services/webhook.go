@@ -0,0 +1,273 @@
+package services
+
+import (
+	"bytes"
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrInvalidCallback is returned for callback URLs webhooks cannot or must not be delivered to
+var ErrInvalidCallback = errors.New("invalid callback URL")
+
+type WebhookServiceInterface interface {
+	Dispatch(ctx context.Context, request models.ReportRequest, result models.ReportResult)
+	Deliver(ctx context.Context, request models.ReportRequest, result models.ReportResult) error
+	Drain(timeout time.Duration) int
+}
+
+type WebhookService struct {
+	cfg    *config.Config
+	rdb    *redis.Client
+	client *http.Client
+
+	pending sync.WaitGroup // Deliveries dispatched in the background
+	running atomic.Int64
+	stopCtx context.Context // Cancelled by Drain to abandon the deliveries still running
+	stop    context.CancelFunc
+}
+
+func NewWebhookService(cfg *config.Config, rdb *redis.Client) WebhookServiceInterface {
+	stopCtx, stop := context.WithCancel(context.Background())
+
+	// Host names are only resolved when connecting, refuse private addresses there as well
+	// (this also covers redirects)
+	dialer := &net.Dialer{Timeout: cfg.Webhook.Timeout}
+	if !cfg.Webhook.AllowPrivateHosts {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+				return fmt.Errorf("%w: %s is not a public address", ErrInvalidCallback, ip)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+
+	return &WebhookService{
+		cfg:     cfg,
+		rdb:     rdb,
+		client:  &http.Client{Timeout: cfg.Webhook.Timeout, Transport: transport},
+		stopCtx: stopCtx,
+		stop:    stop,
+	}
+}
+
+// Dispatch delivers the result to the request's callback URL in the background
+// The delivery outlives ctx, its retries are only cancelled by Drain
+// It is a no-op for requests without a callback URL
+func (s *WebhookService) Dispatch(ctx context.Context, request models.ReportRequest, result models.ReportResult) {
+	if request.CallbackURL == "" {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stopCancel := context.AfterFunc(s.stopCtx, cancel)
+	s.pending.Add(1)
+	s.running.Add(1)
+	go func() {
+		defer s.pending.Done()
+		defer s.running.Add(-1)
+		defer stopCancel()
+		defer cancel()
+
+		if err := s.Deliver(ctx, request, result); err != nil {
+			log.Printf("[Webhook] Giving up delivery for %s: %v", request.ID, err)
+		}
+	}()
+}
+
+// Drain waits up to timeout for the deliveries dispatched in the background
+// Deliveries still running then are cancelled, it returns how many were
+func (s *WebhookService) Drain(timeout time.Duration) int {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return 0
+	case <-time.After(timeout):
+	}
+
+	abandoned := int(s.running.Load())
+	s.stop()
+	<-done
+	return abandoned
+}
+
+// Deliver POSTs the result to the request's callback URL, retrying with exponential backoff
+// Every attempt is recorded in Redis under KEY_PREFIX_WEBHOOK_DELIVERIES
+func (s *WebhookService) Deliver(ctx context.Context, request models.ReportRequest, result models.ReportResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	backoff := s.cfg.Webhook.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		statusCode, err := s.post(ctx, request, body)
+
+		delivery := models.WebhookDelivery{
+			RequestID:   request.ID,
+			URL:         request.CallbackURL,
+			Attempt:     attempt,
+			StatusCode:  statusCode,
+			Success:     err == nil,
+			AttemptedAt: time.Now().UTC(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		s.recordDelivery(ctx, request.Tenant(), delivery)
+
+		if err == nil {
+			log.Printf("[Webhook] Delivered result of %s (attempt %d)", request.ID, attempt)
+			return nil
+		}
+
+		if !isRetryableStatus(statusCode) || errors.Is(err, ErrInvalidCallback) {
+			return err
+		}
+		if attempt >= s.cfg.Webhook.MaxAttempts {
+			return fmt.Errorf("%d attempts failed, last error: %w", attempt, err)
+		}
+
+		log.Printf("[Webhook] Delivery of %s failed (attempt %d), retrying in %s: %v", request.ID, attempt, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > s.cfg.Webhook.MaxBackoff {
+			backoff = s.cfg.Webhook.MaxBackoff
+		}
+	}
+}
+
+// post performs a single signed delivery attempt and returns the response status code
+func (s *WebhookService) post(ctx context.Context, request models.ReportRequest, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, request.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Report-Request-ID", request.ID)
+	if request.CallbackSecret != "" {
+		req.Header.Set(config.WEBHOOK_SIGNATURE_HEADER, "sha256="+SignWebhookPayload(request.CallbackSecret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) // Drain so the connection can be reused
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// recordDelivery appends a delivery attempt to the report's delivery log in Redis
+func (s *WebhookService) recordDelivery(ctx context.Context, tenantID string, delivery models.WebhookDelivery) {
+	deliveryJson, err := json.Marshal(delivery)
+	if err != nil {
+		log.Printf("[Redis] Failed to marshal webhook delivery for %s: %v", delivery.RequestID, err)
+		return
+	}
+
+	key := config.KEY_PREFIX_WEBHOOK_DELIVERIES + models.ReportKey(tenantID, delivery.RequestID)
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, string(deliveryJson))
+		pipe.Expire(ctx, key, 24*time.Hour) // TTL: 24 hours
+		return nil
+	})
+	if err != nil {
+		log.Printf("[Redis] Failed to record webhook delivery for %s: %v", delivery.RequestID, err)
+	}
+}
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 of body using secret
+// Receivers verify a delivery by comparing it with the WEBHOOK_SIGNATURE_HEADER value
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateCallbackURL checks that a callback URL is an absolute http or https URL
+// Unless allowPrivate, hosts that are loopback, private, link-local or unspecified IP addresses,
+// or localhost, are rejected
+func validateCallbackURL(rawURL string, allowPrivate bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCallback, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be http or https, got %q", ErrInvalidCallback, u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: missing host", ErrInvalidCallback)
+	}
+	if allowPrivate {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrInvalidCallback, host)
+	}
+	if host = strings.ToLower(strings.TrimSuffix(host, ".")); host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s is not a public host", ErrInvalidCallback, host)
+	}
+	return nil
+}
+
+// isPrivateIP reports whether ip is not reachable publicly, e.g. a cloud metadata address
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsInterfaceLocalMulticast()
+}
+
+// isRetryableStatus reports whether a failed attempt is worth retrying
+// Network errors (status 0), timeouts, throttling and server errors are retried, other client errors are not
+func isRetryableStatus(statusCode int) bool {
+	switch {
+	case statusCode == 0:
+		return true
+	case statusCode == http.StatusRequestTimeout, statusCode == http.StatusTooManyRequests:
+		return true
+	case statusCode >= 500:
+		return true
+	default:
+		return false
+	}
+}
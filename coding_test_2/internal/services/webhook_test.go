@@ -0,0 +1,77 @@
+package services
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/models"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestValidateCallbackURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		valid        bool
+	}{
+		{"https://hooks.example.com/reports", false, true},
+		{"http://hooks.example.com:8080/reports?token=1", false, true},
+		{"ftp://hooks.example.com/reports", false, false},
+		{"hooks.example.com/reports", false, false},
+		{"https:///reports", false, false},
+		{"http://169.254.169.254/latest/meta-data", false, false},
+		{"http://127.0.0.1:8080/hook", false, false},
+		{"http://[::1]/hook", false, false},
+		{"http://10.0.0.5/hook", false, false},
+		{"http://192.168.1.10/hook", false, false},
+		{"http://0.0.0.0/hook", false, false},
+		{"http://localhost/hook", false, false},
+		{"http://api.localhost./hook", false, false},
+		{"http://127.0.0.1:8080/hook", true, true},
+		{"http://localhost/hook", true, true},
+		{"file:///etc/passwd", true, false},
+	}
+	for _, test := range tests {
+		err := validateCallbackURL(test.url, test.allowPrivate)
+		if test.valid && err != nil {
+			t.Errorf("%s (allow private %v): got %v, want valid", test.url, test.allowPrivate, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidCallback) {
+			t.Errorf("%s (allow private %v): got %v, want ErrInvalidCallback", test.url, test.allowPrivate, err)
+		}
+	}
+}
+
+func TestDeliverRefusesPrivateAddresses(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls++ }))
+	defer server.Close()
+
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer rdb.Close()
+
+	cfg := &config.Config{Webhook: config.WebhookConfig{
+		Timeout: time.Second, MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond,
+	}}
+	request := models.ReportRequest{ID: "report-1", CallbackURL: server.URL}
+
+	// The test server listens on a loopback address, it is refused without retries
+	err := NewWebhookService(cfg, rdb).Deliver(context.Background(), request, models.ReportResult{RequestID: "report-1"})
+	if !errors.Is(err, ErrInvalidCallback) || calls != 0 {
+		t.Fatalf("got %v after %d calls, want ErrInvalidCallback without calls", err, calls)
+	}
+	if attempts := rdb.LLen(context.Background(), config.KEY_PREFIX_WEBHOOK_DELIVERIES+request.Key()).Val(); attempts != 1 {
+		t.Fatalf("got %d recorded attempts, want 1", attempts)
+	}
+
+	cfg.Webhook.AllowPrivateHosts = true
+	if err := NewWebhookService(cfg, rdb).Deliver(context.Background(), request, models.ReportResult{RequestID: "report-1"}); err != nil || calls != 1 {
+		t.Fatalf("got %v after %d calls, want delivered", err, calls)
+	}
+}
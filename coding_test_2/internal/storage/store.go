@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no object is stored under a key
+	ErrNotFound = errors.New("object not found")
+	// ErrSignedURLUnsupported is returned by stores that cannot hand out direct download URLs
+	ErrSignedURLUnsupported = errors.New("signed URLs are not supported by this store")
+)
+
+// ReportStore persists generated report artifacts outside of Redis
+type ReportStore interface {
+	// Name identifies the backend, e.g. "filesystem" or "s3"
+	Name() string
+	// Put stores data under key and returns the location of the stored object
+	Put(ctx context.Context, key string, contentType string, data []byte) (string, error)
+	// Get opens the object stored under key, the caller must close it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// SignedURL returns a URL granting time-limited direct access to the object
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
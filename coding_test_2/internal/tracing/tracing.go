@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"coding_test_2/internal/config"
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans created by this application
+const instrumentationName = "coding_test_2"
+
+// Setup installs the W3C trace context propagator and, when tracing is enabled, a tracer
+// provider exporting spans over OTLP/HTTP; the returned function flushes and stops it
+// With tracing disabled spans are not recorded, but incoming trace context is still passed on
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !cfg.Tracing.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Tracing.Endpoint)}
+	if cfg.Tracing.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.Tracing.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	log.Printf("[Tracing] Exporting spans to %s as %s", cfg.Tracing.Endpoint, cfg.Tracing.ServiceName)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of the span in ctx, if any
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End ends a span, marking it as failed if err is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject writes the trace context of ctx into the carrier
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+// Extract returns ctx with the trace context read from the carrier
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// ReportAttributes describes the report request a span works on
+func ReportAttributes(requestID string, reportType string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("report.id", requestID),
+		attribute.String("report.type", reportType),
+	}
+}
+
+// Fields carries trace context in string-keyed values, e.g. AMQP headers or the values of
+// a Redis stream entry
+type Fields map[string]interface{}
+
+func (h Fields) Get(key string) string {
+	value, _ := h[key].(string)
+	return value
+}
+
+func (h Fields) Set(key string, value string) {
+	h[key] = value
+}
+
+func (h Fields) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// InjectAMQP returns headers with the trace context of ctx added, creating them if needed
+func InjectAMQP(ctx context.Context, headers amqp.Table) amqp.Table {
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	Inject(ctx, Fields(headers))
+	return headers
+}
+
+// ExtractAMQP returns ctx with the trace context read from the headers of an AMQP message
+func ExtractAMQP(ctx context.Context, headers amqp.Table) context.Context {
+	if headers == nil {
+		return ctx
+	}
+	return Extract(ctx, Fields(headers))
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"coding_test_2/internal/api"
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/generators"
 	"coding_test_2/internal/services"
+	"coding_test_2/internal/tracing"
 	"context"
+	"errors"
 	"log"
 	"os"
 	"os/signal"
@@ -12,6 +17,11 @@ import (
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
 	log.Println("Starting Report Processing System...")
 	defer log.Println("Report Processing System stopped gracefully")
 
@@ -29,8 +39,22 @@ func main() {
 		cancel()
 	}()
 
+	// Set up trace propagation and export
+	shutdownTracing, err := tracing.Setup(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer func() {
+		// Flush the spans still buffered
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+
 	// Connect to Redis
-	rdb, err := connectRedis(ctx)
+	rdb, err := connectRedis(ctx, cfg)
 	if err != nil {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
@@ -40,8 +64,11 @@ func main() {
 		log.Println("Redis connection closed")
 	}()
 
+	// Generators of every supported report type, each type gets its own queue
+	registry := generators.NewDefaultRegistry()
+
 	// Connect to RabbitMQ
-	conn, ch, err := connectRabbitMQ(ctx)
+	conn, err := connectRabbitMQ(ctx, cfg, registry.Types())
 	if err != nil {
 		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
 	}
@@ -51,31 +78,113 @@ func main() {
 		log.Println("RabbitMQ connection closed")
 	}()
 
-	// Create producer and consumer services
-	producer := services.NewProducerService(ch)
+	// Create the report artifact store
+	store, err := connectReportStore(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Failed to create report store: %v", err)
+	}
 
 	// Start both producer and consumer concurrently
 	var wg sync.WaitGroup
 
+	// Watch for configuration reloads
+	reloads := make(chan *config.Config)
+	go watchConfig(ctx, os.Args[1:], cfg, reloads)
+
+	// Health checks of the dependencies, the processor adds its consumers and workers
+	health := services.NewHealthService()
+	health.AddReadinessCheck("redis", func(ctx context.Context) error {
+		return rdb.Ping(ctx).Err()
+	})
+	health.AddReadinessCheck("rabbitmq", func(ctx context.Context) error {
+		if !conn.IsConnected() {
+			return errors.New("not connected")
+		}
+		return nil
+	})
+
 	// Start consumer
+	drained := make(chan struct{}) // Closed once the consumer has drained its in-flight reports
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := StartReportProcessor(ctx, &wg, ch, rdb); err != nil && err != context.Canceled {
+		defer close(drained)
+		if err := StartReportProcessor(ctx, &wg, cfg, conn, rdb, registry, store, reloads, health); err != nil && err != context.Canceled {
 			log.Printf("Consumer error: %v", err)
 		}
 	}()
 
+	// Start outbox relay, the only publisher of report requests
+	outbox := services.NewOutboxService(cfg, rdb, conn)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := outbox.Relay(ctx); err != nil && err != context.Canceled {
+			log.Printf("Outbox relay error: %v", err)
+		}
+	}()
+
+	// Start HTTP API
+	reports := services.NewReportService(cfg, rdb, store, registry, outbox, services.NewRateLimiterService(cfg, rdb))
+	schedules := services.NewSchedulerService(cfg, rdb, registry, reports)
+	server := api.NewServer(services.NewNotifierService(rdb), reports, schedules, health)
+	// Keep serving during the drain so readiness reports it
+	httpCtx, stopHTTP := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		<-ctx.Done()
+		<-drained
+		stopHTTP()
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := startHTTPServer(httpCtx, cfg, server); err != nil {
+			log.Printf("HTTP server error: %v", err)
+		}
+	}()
+
+	// Start scheduler, only the elected leader among the instances fires schedules
+	if cfg.Scheduler.Enabled {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := schedules.Run(ctx); err != nil && err != context.Canceled {
+				log.Printf("Scheduler error: %v", err)
+			}
+		}()
+	}
+
+	// Start reaper, recovering reports of workers that stopped renewing their lease
+	reaper := services.NewReaperService(cfg, rdb)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := reaper.Run(ctx); err != nil && err != context.Canceled {
+			log.Printf("Reaper error: %v", err)
+		}
+	}()
+
 	// Give consumer time to start
 	time.Sleep(2 * time.Second)
 
-	// Start producer
+	// Start producer, it submits through the outbox like the API
+	producer := services.NewProducerService(cfg, outbox)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := producer.ProduceReportRequests(ctx, &wg); err != nil && err != context.Canceled {
+		summary, err := producer.ProduceReportRequests(ctx, &wg)
+		if err != nil && err != context.Canceled {
 			log.Printf("Producer error: %v", err)
 		}
+		if summary != nil && len(summary.Existing)+len(summary.Failed) > 0 {
+			log.Printf("Producer: not submitted (existing %v, failed %v)", summary.Existing, summary.Failed)
+		}
+		if summary != nil && summary.Publish != nil {
+			if publish := summary.Publish; !publish.Settled() || len(publish.DeadLettered) > 0 {
+				log.Printf("Producer: not confirmed (nacked %v, returned %v, failed %v, dead-lettered %v, pending %v)",
+					publish.Nacked, publish.Returned, publish.Failed, publish.DeadLettered, publish.Pending)
+			}
+		}
 	}()
 
 	// Wait for all goroutines
@@ -1,114 +1,396 @@
 package main
 
 import (
+	"coding_test_2/internal/broker"
 	"coding_test_2/internal/config"
+	"coding_test_2/internal/generators"
+	"coding_test_2/internal/messages"
+	"coding_test_2/internal/metrics"
 	"coding_test_2/internal/models"
 	"coding_test_2/internal/services"
+	"coding_test_2/internal/storage"
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/streadway/amqp"
 )
 
-func StartReportProcessor(ctx context.Context, wg *sync.WaitGroup, ch *amqp.Channel, rdb *redis.Client) error {
-	s := services.NewConsumerService(rdb, ch)
+// StartReportProcessor orchestrates the consumer side
+// Every report type is consumed from its own queue by a dedicated worker pool, so slow
+// types do not hold up fast ones; it runs until ctx is cancelled
+// Configs received on reloads resize the worker pools and update their per-task timeout and prefetch
+// On cancellation it drains the processors before returning, see drain
+// Consumers and worker pools are registered with health, which reports the serving and draining phases
+func StartReportProcessor(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, conn *broker.Connection, rdb *redis.Client, registry *generators.Registry, store storage.ReportStore, reloads <-chan *config.Config, health services.HealthServiceInterface) error {
+	webhook := services.NewWebhookService(cfg, rdb)
 	log.Println("[Consumer] Starting report processor...")
 
-	// Set QoS to limit unacknowledged messages per worker
-	err := ch.Qos(
-		1,     // prefetch count - only 1 unacknowledged message per worker
-		0,     // prefetch size
-		false, // global
-	)
-	if err != nil {
-		return fmt.Errorf("failed to set QoS: %w", err)
+	// Workers, acknowledgments and consumer channels outlive ctx until the drain is over
+	workCtx, stopWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopWork()
+
+	processors := make(map[string]*typeProcessor)
+	for _, reportType := range registry.Types() {
+		s := services.NewConsumerService(cfg, rdb, webhook, registry, store)
+		p, err := startTypeProcessor(ctx, workCtx, wg, cfg, conn, s, reportType)
+		if err != nil {
+			return err
+		}
+		processors[reportType] = p
+		p.registerHealthChecks(cfg, health)
+	}
+	health.SetPhase(services.PhaseServing)
+
+	// Apply reloaded configs until context cancellation
+	drainTimeout := cfg.Consumer.DrainTimeout
+	for {
+		select {
+		case newCfg := <-reloads:
+			for reportType, p := range processors {
+				p.apply(newCfg.Consumer.ForType(reportType))
+			}
+			drainTimeout = newCfg.Consumer.DrainTimeout
+		case <-ctx.Done():
+			log.Printf("[Consumer] Shutting down, draining in-flight reports (timeout %s)...", drainTimeout)
+			health.SetPhase(services.PhaseDraining)
+			deadline := time.Now().Add(drainTimeout)
+			drain(processors, drainTimeout)
+
+			// Callbacks of the finished reports get the rest of the timeout, their messages are acked already
+			if abandoned := webhook.Drain(max(time.Until(deadline), abortGrace)); abandoned > 0 {
+				log.Printf("[Consumer] Drain timeout reached, abandoned %d webhook deliveries", abandoned)
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// abortGrace is how long tasks interrupted at the end of a drain get to requeue their reports,
+// and the least webhook deliveries get to finish once the workers stopped
+const abortGrace = 5 * time.Second
+
+// drain stops consuming and lets the workers finish their tasks within timeout
+// Tasks still running then are interrupted and their reports requeued as RETRYING; workers
+// that do not return in time are abandoned, their deliveries are requeued by the broker once
+// the consumer channels close
+func drain(processors map[string]*typeProcessor, timeout time.Duration) {
+	// The distributors stop as well and requeue the deliveries no worker has picked up
+	for _, p := range processors {
+		if err := p.consumer.Cancel(); err != nil {
+			log.Printf("[Consumer] %v", err)
+		}
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		for _, p := range processors {
+			p.pool.Wait()
+		}
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(timeout):
+		interrupted := 0
+		for _, p := range processors {
+			interrupted += p.s.AbortTasks(services.ErrShuttingDown)
+		}
+		log.Printf("[Consumer] Drain timeout reached, interrupted %d running tasks", interrupted)
+
+		select {
+		case <-drained:
+		case <-time.After(abortGrace):
+			log.Println("[Consumer] Workers did not stop in time, leaving their deliveries to the broker")
+			return
+		}
+	}
+
+	// No worker sends results anymore, let the ack handlers settle the remaining ones
+	for _, p := range processors {
+		close(p.results)
+		<-p.acked
 	}
+	log.Println("[Consumer] All workers stopped")
+}
 
-	// Start consuming messages
-	msgs, err := ch.Consume(
-		config.QUEUE_NAME, // queue
-		"",                // consumer
-		false,             // auto-ack (we'll manually ack)
-		false,             // exclusive
-		false,             // no-local
-		false,             // no-wait
-		nil,               // args
-	)
+// typeProcessor consumes the queue of a single report type with its own worker pool
+type typeProcessor struct {
+	reportType string
+	s          services.ConsumerServiceInterface
+	consumer   *broker.Consumer
+	pool       *services.WorkerPool
+	results    chan models.ReportResult
+	acked      chan struct{} // Closed once the ack handler has returned
+}
+
+// startTypeProcessor starts consuming the queue of reportType with the type's pool settings
+// Deliveries are dispatched until ctx is cancelled, everything else runs until workCtx is
+func startTypeProcessor(ctx, workCtx context.Context, wg *sync.WaitGroup, cfg *config.Config, conn *broker.Connection, s services.ConsumerServiceInterface, reportType string) (*typeProcessor, error) {
+	settings := cfg.Consumer.ForType(reportType)
+	s.SetWorkerTimeout(settings.WorkerTimeout)
+
+	// Start consuming messages, limiting unacknowledged messages to the type's prefetch
+	// The consumer is re-registered automatically after a reconnection
+	queue := cfg.RabbitMQ.Queue(reportType)
+	consumer, err := conn.Consume(workCtx, queue, settings.Prefetch)
 	if err != nil {
-		return fmt.Errorf("failed to register a consumer: %w", err)
+		return nil, err
 	}
 
 	// Create channels for worker communication
-	results := make(chan models.ReportResult, config.NUM_WORKERS*2) // Buffered channel
-	deliveries := make(map[string]amqp.Delivery)
-	// var deliveriesMu sync.Mutex
+	results := make(chan models.ReportResult, settings.NumWorkers*2) // Buffered channel
+	deliveries := services.NewDeliveryTracker()
+
+	// Abort running tasks of cancelled reports
+	go func() {
+		if err := s.WatchControl(workCtx); err != nil && err != context.Canceled {
+			log.Printf("[Consumer] Control channel error (%s): %v", reportType, err)
+		}
+	}()
 
 	// Start result acknowledgment handler
-	go s.ResultAckHandler(ctx, results, deliveries)
+	acked := make(chan struct{})
+	go func() {
+		defer close(acked)
+		s.ResultAckHandler(workCtx, results, deliveries)
+	}()
 
 	// Start workers
-	workerMsgs := make(chan amqp.Delivery, config.NUM_WORKERS)
-
-	for i := 1; i <= config.NUM_WORKERS; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			s.ReportWorker(ctx, workerID, workerMsgs, results)
-		}(i)
+	// Unbuffered so the distributor picks the next delivery only once a worker is free
+	workerMsgs := make(chan services.Delivery)
+	pool := services.NewWorkerPool(workCtx, wg, s, reportType, workerMsgs, results, nil)
+	if err := pool.Resize(settings.NumWorkers); err != nil {
+		return nil, err
 	}
 
+	metrics.ObserveWorkerPool(reportType, pool.Alive, deliveries.Len)
+
 	// Message distributor
-	go func() {
-		defer close(workerMsgs)
-		defer close(results)
+	go distributeDeliveries(workCtx, ctx.Done(), cfg, s, consumer.Deliveries(), workerMsgs, deliveries)
 
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("[Consumer] Context cancelled, stopping message distribution")
-				return
-			case msg, ok := <-msgs:
-				if !ok {
-					log.Println("[Consumer] Message channel closed")
-					return
-				}
+	log.Printf("[Consumer] Started %d workers for %s reports on %s (prefetch %d, timeout %s)",
+		settings.NumWorkers, reportType, queue, settings.Prefetch, settings.WorkerTimeout)
 
-				// Parse request to get ID for tracking
-				var request models.ReportRequest
-				if err := json.Unmarshal(msg.Body, &request); err != nil {
-					log.Printf("[Consumer] Failed to parse message for tracking: %v", err)
-					msg.Nack(false, false)
-					continue
-				}
+	return &typeProcessor{
+		reportType: reportType,
+		s:          s,
+		consumer:   consumer,
+		pool:       pool,
+		results:    results,
+		acked:      acked,
+	}, nil
+}
 
-				// Store delivery for later acknowledgment
-				deliveries[request.ID] = msg
+// registerHealthChecks adds the consumer registration to readiness and the workers to liveness
+// Workers are alive if they all run and none is stuck on a task for longer than the claim lease
+func (p *typeProcessor) registerHealthChecks(cfg *config.Config, health services.HealthServiceInterface) {
+	health.AddReadinessCheck("consumer:"+p.reportType, func(context.Context) error {
+		if !p.consumer.Registered() {
+			return fmt.Errorf("not consuming %s", cfg.RabbitMQ.Queue(p.reportType))
+		}
+		return nil
+	})
+	health.AddLivenessCheck("workers:"+p.reportType, func(context.Context) error {
+		if health.Phase() == services.PhaseDraining {
+			return nil // Workers stop on purpose
+		}
+		if alive, size := p.pool.Alive(), p.pool.Size(); alive < size {
+			return fmt.Errorf("%d of %d workers running", alive, size)
+		}
+		if longest := p.s.LongestTask(); longest > cfg.Consumer.ClaimLease {
+			return fmt.Errorf("a task has been running for %s", longest.Round(time.Second))
+		}
+		return nil
+	})
+}
 
-				// Update status to PENDING
-				s.UpdateReportStatus(ctx, request.ID, models.StatusPending, "", "")
+// apply updates the pool size, per-task timeout and prefetch of the processor
+func (p *typeProcessor) apply(settings config.TypeConsumerConfig) {
+	p.s.SetWorkerTimeout(settings.WorkerTimeout)
+	if err := p.pool.Resize(settings.NumWorkers); err != nil {
+		log.Printf("[Consumer] Failed to apply reloaded config for %s: %v", p.reportType, err)
+		return
+	}
+	if err := p.consumer.SetPrefetch(settings.Prefetch); err != nil {
+		log.Printf("[Consumer] Failed to apply reloaded config for %s: %v", p.reportType, err)
+		return
+	}
+	log.Printf("[Consumer] Applied reloaded config for %s: %d workers, %s worker timeout, prefetch %d",
+		p.reportType, settings.NumWorkers, settings.WorkerTimeout, settings.Prefetch)
+}
 
-				// Forward to workers
-				select {
-				case workerMsgs <- msg:
-				case <-ctx.Done():
-					return
-				}
+// tenantRetryInterval is how often deliveries of tenants at their concurrency cap are retried
+const tenantRetryInterval = 500 * time.Millisecond
+
+// unsupportedRequeueDelay is how long messages of a newer schema version are held before
+// they are requeued, so they do not bounce between the queue and this consumer until one
+// that knows the version (e.g. after a rolling deploy) receives them
+// After MaxUnsupportedRequeues requeues no consumer is expected to, they are dead-lettered
+const unsupportedRequeueDelay = 5 * time.Second
+
+// messageKey identifies a delivery across requeues, by its message ID or else its body
+func messageKey(msg amqp.Delivery) string {
+	if msg.MessageId != "" {
+		return msg.MessageId
+	}
+	sum := sha256.Sum256(msg.Body)
+	return hex.EncodeToString(sum[:])
+}
+
+// distributeDeliveries tracks deliveries for acknowledgment and hands them to the workers
+// Duplicates of in-flight requests and cancelled requests are not forwarded, invalid messages
+// are dead-lettered and those of a newer schema version requeued, see unsupportedRequeueDelay
+// Deliveries are buffered per tenant and dispatched by weighted fair scheduling, tenants at
+// their concurrency cap wait; the buffer is bounded by the queue's prefetch, which should
+// exceed the caps for other tenants to get through while one is capped
+// It returns once stop is closed or msgs is, requeueing the deliveries it still buffers, and
+// closes workerMsgs so the workers return after their current task
+func distributeDeliveries(ctx context.Context, stop <-chan struct{}, cfg *config.Config, s services.ConsumerServiceInterface, msgs <-chan amqp.Delivery, workerMsgs chan<- services.Delivery, deliveries *services.DeliveryTracker) {
+	defer close(workerMsgs)
+	distributor := s.Instance() + "/distributor" // Recorded in status histories, like the workers
+
+	queue := services.NewFairQueue[services.Delivery](func(tenantID string) int {
+		return cfg.Tenants.ForTenant(tenantID).Weight
+	})
+	admit := func(tenantID string, pending services.Delivery) bool {
+		acquired, err := s.AcquireTenantSlot(ctx, tenantID, pending.Request.ID)
+		if err != nil {
+			// Rather exceed the cap than stall processing while Redis is unavailable
+			log.Printf("[Consumer] %v", err)
+			return true
+		}
+		return acquired
+	}
+
+	retry := time.NewTicker(tenantRetryInterval)
+	defer retry.Stop()
+
+	var next services.Delivery
+	var dispatch chan<- services.Delivery // Set while next waits for a worker, nil disables the send
+	defer func() {
+		pending := queue.Drain()
+		if dispatch != nil {
+			pending = append(pending, next)
+			// Its tenant slot was taken when it was admitted
+			if err := s.ReleaseTenantSlot(ctx, next.Request.Tenant(), next.Request.ID); err != nil {
+				log.Printf("[Consumer] %v", err)
 			}
 		}
+		for _, p := range pending {
+			deliveries.Take(p.Request.Key())
+			if err := p.Nack(false, true); err != nil {
+				log.Printf("[Consumer] Failed to requeue message for %s: %v", p.Request.ID, err)
+				metrics.RabbitMQErrors.WithLabelValues("nack").Inc()
+				continue
+			}
+			metrics.Nacked.WithLabelValues(p.Request.ReportType).Inc()
+		}
+		if len(pending) > 0 {
+			log.Printf("[Consumer] Requeued %d undispatched deliveries", len(pending))
+		}
 	}()
 
-	log.Printf("[Consumer] Started %d workers, waiting for messages...", config.NUM_WORKERS)
+	for {
+		if dispatch == nil && queue.Len() > 0 {
+			if pending, ok := queue.Next(admit); ok {
+				next, dispatch = pending, workerMsgs
+			}
+		}
 
-	// Wait for context cancellation
-	<-ctx.Done()
-	log.Println("[Consumer] Shutting down...")
+		select {
+		case <-ctx.Done():
+			log.Println("[Consumer] Context cancelled, stopping message distribution")
+			return
+		case <-stop:
+			log.Println("[Consumer] Shutting down, stopping message distribution")
+			return
+		case dispatch <- next:
+			// Forwarded to a worker
+			dispatch = nil
+		case <-retry.C:
+			// Slots of capped tenants may have been freed
+		case msg, ok := <-msgs:
+			if !ok {
+				log.Println("[Consumer] Message channel closed")
+				return
+			}
 
-	// Wait for workers to finish
-	log.Println("[Consumer] All workers stopped")
+			// Validate and upcast the message once, workers and the ack handler get it decoded
+			envelope, request, err := messages.DecodeReportRequest(msg.Body)
+			if errors.Is(err, messages.ErrUnsupportedVersion) {
+				// A failed count requeues the message anyway, the delay keeps it from looping fast
+				requeues, countErr := s.CountUnsupportedRequeue(ctx, messageKey(msg))
+				if countErr != nil {
+					log.Printf("[Consumer] %v", countErr)
+				} else if requeues > int64(cfg.Consumer.MaxUnsupportedRequeues) {
+					log.Printf("[Consumer] Dead-lettering message %s after %d requeues: %v", msg.MessageId, requeues-1, err)
+					msg.Nack(false, false)
+					metrics.Consumed.WithLabelValues(metrics.UnknownType).Inc()
+					metrics.Nacked.WithLabelValues(metrics.UnknownType).Inc()
+					metrics.DeadLettered.WithLabelValues(metrics.UnknownType).Inc()
+					continue
+				}
+				log.Printf("[Consumer] Requeueing message %s in %s: %v", msg.MessageId, unsupportedRequeueDelay, err)
+				metrics.Consumed.WithLabelValues(metrics.UnknownType).Inc()
+				time.AfterFunc(unsupportedRequeueDelay, func() {
+					if err := msg.Nack(false, true); err != nil {
+						log.Printf("[Consumer] Failed to requeue message %s: %v", msg.MessageId, err)
+						metrics.RabbitMQErrors.WithLabelValues("nack").Inc()
+						return
+					}
+					metrics.Nacked.WithLabelValues(metrics.UnknownType).Inc()
+				})
+				continue
+			}
+			if err != nil {
+				log.Printf("[Consumer] Dead-lettering message %s: %v", msg.MessageId, err)
+				msg.Nack(false, false)
+				metrics.Consumed.WithLabelValues(metrics.UnknownType).Inc()
+				metrics.Nacked.WithLabelValues(metrics.UnknownType).Inc()
+				metrics.DeadLettered.WithLabelValues(metrics.UnknownType).Inc()
+				continue
+			}
+			delivery := services.Delivery{Delivery: msg, Envelope: *envelope, Request: *request}
+			metrics.Consumed.WithLabelValues(request.ReportType).Inc()
+			if msg.Redelivered {
+				metrics.Retried.WithLabelValues(request.ReportType).Inc()
+			}
+
+			// A duplicate of a request already being processed here is not handed to another worker
+			if deliveries.Has(request.Key()) {
+				if msg.Redelivered {
+					// Our earlier delivery was lost with its channel, ack this one once the worker is done
+					log.Printf("[Consumer] Request %s redelivered while in progress, tracking new delivery", request.ID)
+					deliveries.Track(request.Key(), delivery)
+				} else {
+					log.Printf("[Consumer] Request %s is already in progress, acking duplicate delivery", request.ID)
+					msg.Ack(false)
+					metrics.Acked.WithLabelValues(request.ReportType).Inc()
+				}
+				continue
+			}
+
+			// Update status to PENDING, the state machine rejects it if the report was recorded already
+			_, err = s.UpdateReportStatus(ctx, distributor, request.Tenant(), request.ID, models.StatusPending, nil, "")
+			var transitionErr *models.TransitionError
+			if errors.As(err, &transitionErr) && transitionErr.From == models.StatusCancelled {
+				log.Printf("[Consumer] Request %s was cancelled, dropping delivery", request.ID)
+				msg.Ack(false)
+				metrics.Acked.WithLabelValues(request.ReportType).Inc()
+				continue
+			}
 
-	return ctx.Err()
+			// Store delivery for later acknowledgment and queue it behind the tenant's others
+			deliveries.Track(request.Key(), delivery)
+			queue.Push(request.Tenant(), delivery)
+		}
+	}
 }
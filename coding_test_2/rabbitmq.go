@@ -1,41 +1,107 @@
 package main
 
 import (
+	"coding_test_2/internal/broker"
 	"coding_test_2/internal/config"
 	"context"
-	"fmt"
 	"log"
 
 	"github.com/streadway/amqp"
 )
 
-// connectRabbitMQ establishes a connection and channel to RabbitMQ
-func connectRabbitMQ(ctx context.Context) (*amqp.Connection, *amqp.Channel, error) {
-	conn, err := amqp.Dial(config.RABBITMQ_URL)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
-	}
+// connectRabbitMQ establishes a self-healing connection to RabbitMQ
+// The topic exchange and one priority queue per report type, bound by the type's
+// routing key, are (re)declared on every connection
+// Deliveries the queues reject without requeue are dead-lettered to a single queue for inspection
+func connectRabbitMQ(ctx context.Context, cfg *config.Config, reportTypes []string) (*broker.Connection, error) {
+	topology := func(ch *amqp.Channel) error {
+		err := ch.ExchangeDeclare(
+			cfg.RabbitMQ.DeadLetterExchange(), // name
+			amqp.ExchangeFanout,               // kind
+			true,                              // durable
+			false,                             // delete when unused
+			false,                             // internal
+			false,                             // no-wait
+			nil,                               // arguments
+		)
+		if err != nil {
+			return err
+		}
+		_, err = ch.QueueDeclare(
+			cfg.RabbitMQ.DeadLetterQueue(), // name
+			true,                           // durable
+			false,                          // delete when unused
+			false,                          // exclusive
+			false,                          // no-wait
+			nil,                            // arguments
+		)
+		if err != nil {
+			return err
+		}
+		err = ch.QueueBind(
+			cfg.RabbitMQ.DeadLetterQueue(),    // name
+			"",                                // routing key, ignored by the fanout exchange
+			cfg.RabbitMQ.DeadLetterExchange(), // exchange
+			false,                             // no-wait
+			nil,                               // arguments
+		)
+		if err != nil {
+			return err
+		}
 
-	ch, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		return nil, nil, fmt.Errorf("failed to open a channel: %w", err)
+		err = ch.ExchangeDeclare(
+			cfg.RabbitMQ.Exchange, // name
+			amqp.ExchangeTopic,    // kind
+			true,                  // durable
+			false,                 // delete when unused
+			false,                 // internal
+			false,                 // no-wait
+			nil,                   // arguments
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, reportType := range reportTypes {
+			queue := cfg.RabbitMQ.Queue(reportType)
+			_, err := ch.QueueDeclare(
+				queue, // name
+				true,  // durable
+				false, // delete when unused
+				false, // exclusive
+				false, // no-wait
+				amqp.Table{
+					"x-max-priority":         cfg.Priority.Max, // Higher priority requests are delivered first
+					"x-dead-letter-exchange": cfg.RabbitMQ.DeadLetterExchange(),
+				},
+			)
+			if err != nil {
+				return err
+			}
+
+			err = ch.QueueBind(
+				queue,                               // name
+				cfg.RabbitMQ.RoutingKey(reportType), // routing key
+				cfg.RabbitMQ.Exchange,               // exchange
+				false,                               // no-wait
+				nil,                                 // arguments
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	_, err = ch.QueueDeclare(
-		config.QUEUE_NAME, // name
-		true,              // durable
-		false,             // delete when unused
-		false,             // exclusive
-		false,             // no-wait
-		nil,               // arguments
-	)
+	conn, err := broker.Dial(ctx, broker.Options{
+		URL:            cfg.RabbitMQ.URL,
+		InitialBackoff: cfg.RabbitMQ.ReconnectInitialBackoff,
+		MaxBackoff:     cfg.RabbitMQ.ReconnectMaxBackoff,
+	}, topology)
 	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, nil, fmt.Errorf("failed to declare a queue: %w", err)
+		return nil, err
 	}
 
-	log.Println("Successfully connected to RabbitMQ and declared queue:", config.QUEUE_NAME)
-	return conn, ch, nil
+	log.Printf("Successfully connected to RabbitMQ and declared exchange %s with queues for %v", cfg.RabbitMQ.Exchange, reportTypes)
+	return conn, nil
 }
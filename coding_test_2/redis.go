@@ -2,6 +2,7 @@ package main
 
 import (
 	"coding_test_2/internal/config"
+	"coding_test_2/internal/metrics"
 	"context"
 	"log"
 
@@ -9,11 +10,13 @@ import (
 )
 
 // connectRedis establishes a connection to Redis
-func connectRedis(ctx context.Context) (*redis.Client, error) {
+func connectRedis(ctx context.Context, cfg *config.Config) (*redis.Client, error) {
 	rdb := redis.NewClient(&redis.Options{
-		Addr: config.REDIS_URL,
-		DB:   0, // use default DB
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
 	})
+	rdb.AddHook(metrics.RedisHook{})
 
 	// Use the provided context for the Ping operation
 	err := rdb.Ping(ctx).Err()
@@ -21,6 +24,6 @@ func connectRedis(ctx context.Context) (*redis.Client, error) {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
 
-	log.Println("Successfully connected to Redis:", config.REDIS_URL)
+	log.Println("Successfully connected to Redis:", cfg.Redis.Addr)
 	return rdb, nil
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"coding_test_2/internal/config"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 5 * time.Second
+
+// watchConfig reloads the configuration on SIGHUP or when the config file changes
+// Valid configs are sent on reloads, invalid ones are logged and ignored
+// Only the worker pool size and worker timeout are applied at runtime, other changes need a restart
+func watchConfig(ctx context.Context, args []string, cfg *config.Config, reloads chan<- *config.Config) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	lastModified := fileModTime(cfg.File())
+
+	reload := func(reason string) {
+		newCfg, err := config.Load(args)
+		if err != nil {
+			log.Printf("[Config] Ignoring reload (%s): %v", reason, err)
+			return
+		}
+		log.Printf("[Config] Reloaded configuration (%s)", reason)
+
+		select {
+		case reloads <- newCfg:
+		case <-ctx.Done():
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reload("SIGHUP")
+		case <-ticker.C:
+			if cfg.File() == "" {
+				continue
+			}
+			if modified := fileModTime(cfg.File()); !modified.Equal(lastModified) {
+				lastModified = modified
+				reload("config file changed")
+			}
+		}
+	}
+}
+
+// fileModTime returns the modification time of path, or the zero time if it cannot be read
+func fileModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"coding_test_2/internal/config"
+	"coding_test_2/internal/storage"
+	"context"
+	"fmt"
+	"log"
+)
+
+// connectReportStore creates the report artifact store selected by the storage backend
+func connectReportStore(ctx context.Context, cfg *config.Config) (storage.ReportStore, error) {
+	switch cfg.Storage.Backend {
+	case "filesystem":
+		store, err := storage.NewFileStore(cfg.Storage.Dir)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Storing report artifacts in:", cfg.Storage.Dir)
+		return store, nil
+	case "s3":
+		store, err := storage.NewS3Store(ctx, storage.S3Config{
+			Endpoint:  cfg.Storage.S3.Endpoint,
+			Bucket:    cfg.Storage.S3.Bucket,
+			Region:    cfg.Storage.S3.Region,
+			AccessKey: cfg.Storage.S3.AccessKey,
+			SecretKey: cfg.Storage.S3.SecretKey,
+			UseSSL:    cfg.Storage.S3.UseSSL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Storing report artifacts in bucket %s at %s", cfg.Storage.S3.Bucket, cfg.Storage.S3.Endpoint)
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}